@@ -0,0 +1,197 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"gocrawler/spider"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type Mode string
+
+const (
+	Record      Mode = "record"      // 总是发出请求，并保存响应
+	Replay      Mode = "replay"      // 只使用保存的响应，未命中时返回 ErrMiss
+	Passthrough Mode = "passthrough" // 保存的响应未过期时直接使用，否则发出请求并更新
+)
+
+// 重放模式下没有保存的响应
+var ErrMiss = errors.New("cache miss")
+
+// 保存在磁盘上的响应，状态码不为 200 时只保存状态码
+type entry struct {
+	URL       string      `json:"url"`
+	Method    string      `json:"method"`
+	Fetched   time.Time   `json:"fetched"`
+	Status    int         `json:"status"`
+	Header    http.Header `json:"header,omitempty"`
+	FinalURL  string      `json:"final_url,omitempty"`
+	Redirects []string    `json:"redirects,omitempty"`
+	Charset   string      `json:"charset,omitempty"`
+	Body      string      `json:"body,omitempty"` // 已经转换为 UTF-8，保存为字符串便于查看与修改
+}
+
+func (e *entry) response() (*spider.Response, error) {
+	if e.Status != http.StatusOK {
+		return nil, &spider.StatusError{Code: e.Status}
+	}
+	return &spider.Response{
+		StatusCode: e.Status,
+		Header:     e.Header,
+		URL:        e.FinalURL,
+		Redirects:  e.Redirects,
+		Charset:    e.Charset,
+		Body:       []byte(e.Body),
+	}, nil
+}
+
+// Cache 按 Request.Unique() 将响应保存在 dir 下，每个请求一个 JSON 文件
+type Cache struct {
+	Dir    string
+	Mode   Mode
+	TTL    time.Duration // Passthrough 模式下响应的有效期，为 0 时永不过期
+	Logger *zap.Logger
+}
+
+func New(dir string, mode Mode, ttl time.Duration) (*Cache, error) {
+	switch mode {
+	case Record, Replay, Passthrough:
+	default:
+		return nil, fmt.Errorf("unknown cache mode:%s", mode)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Cache{Dir: dir, Mode: mode, TTL: ttl, Logger: zap.NewNop()}, nil
+}
+
+func (c *Cache) path(req *spider.Request) string {
+	key := req.Unique()
+	return filepath.Join(c.Dir, key[:2], key+".json")
+}
+
+func (c *Cache) load(req *spider.Request) (*entry, error) {
+	data, err := os.ReadFile(c.path(req))
+	if os.IsNotExist(err) {
+		return nil, ErrMiss
+	}
+	if err != nil {
+		return nil, err
+	}
+	var e entry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, fmt.Errorf("decode cache of %s failed:%w", req.URL, err)
+	}
+	return &e, nil
+}
+
+// 读取保存的响应，未命中时返回 ErrMiss
+func (c *Cache) Get(req *spider.Request) (*spider.Response, error) {
+	e, err := c.load(req)
+	if err != nil {
+		return nil, err
+	}
+	return e.response()
+}
+
+// 保存响应，resp 为空时只保存状态码
+func (c *Cache) Put(req *spider.Request, status int, resp *spider.Response) error {
+	e := entry{
+		URL:     req.FullURL(),
+		Method:  req.HTTPMethod(),
+		Fetched: time.Now(),
+		Status:  status,
+	}
+	if resp != nil {
+		e.Header = resp.Header
+		e.FinalURL = resp.URL
+		e.Redirects = resp.Redirects
+		e.Charset = resp.Charset
+		e.Body = string(resp.Body)
+	}
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := c.path(req)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	// 先写临时文件再重命名，避免读到写了一半的文件
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// 保存实际请求的结果，只保存成功的响应与状态码错误
+// 未通过任务内容校验的响应与封禁页面不保存，例如验证码页面，之后的请求会重新抓取
+func (c *Cache) save(req *spider.Request, resp *spider.Response, err error) error {
+	var v *spider.Validation
+	if req.Task != nil {
+		v = req.Task.Validation(req.RuleName)
+	}
+	if err == nil {
+		if v.Validate(resp) != nil {
+			return nil
+		}
+		return c.Put(req, resp.StatusCode, resp)
+	}
+	var se *spider.StatusError
+	if errors.As(err, &se) {
+		if v.BannedStatus(se.Code) {
+			return nil
+		}
+		var ve *spider.ValidationError
+		if se.Response != nil && errors.As(v.Validate(se.Response), &ve) && ve.Banned {
+			return nil
+		}
+		return c.Put(req, se.Code, nil)
+	}
+	return nil
+}
+
+func (c *Cache) Middleware() spider.Middleware {
+	return func(next spider.Fetcher) spider.Fetcher {
+		return spider.FetchFunc(func(req *spider.Request) (*spider.Response, error) {
+			switch c.Mode {
+			case Replay:
+				resp, err := c.Get(req)
+				if errors.Is(err, ErrMiss) {
+					return nil, fmt.Errorf("%w:%s", ErrMiss, req.FullURL())
+				}
+				return resp, err
+			case Passthrough:
+				e, err := c.load(req)
+				if err == nil && (c.TTL <= 0 || time.Since(e.Fetched) < c.TTL) {
+					return e.response()
+				}
+			}
+			resp, err := next.Get(req)
+			if serr := c.save(req, resp, err); serr != nil {
+				c.Logger.Error("save cache failed", zap.String("url", req.URL), zap.Error(serr))
+			}
+			return resp, err
+		})
+	}
+}
+
+// 使用保存的响应执行请求对应规则的解析流程，包括解析函数、提取规则与分页规则，
+// 不经过引擎与内容校验，可以在解析规则的单元测试中重放录制的页面
+func (c *Cache) Parse(req *spider.Request) (spider.ParseResult, error) {
+	resp, err := c.Get(req)
+	if err != nil {
+		return spider.ParseResult{}, err
+	}
+	rule, ok := req.Task.Rule.Trunk[req.RuleName]
+	if !ok {
+		return spider.ParseResult{}, fmt.Errorf("rule %s not found", req.RuleName)
+	}
+	return rule.Parse(&spider.Context{Body: resp.Body, Req: req, Resp: resp})
+}
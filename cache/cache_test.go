@@ -0,0 +1,127 @@
+package cache
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"gocrawler/spider"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+	calls := 0
+	origin := spider.FetchFunc(func(req *spider.Request) (*spider.Response, error) {
+		calls++
+		if req.URL == "http://a.com/missing" {
+			return nil, &spider.StatusError{Code: 404}
+		}
+		if req.URL == "http://a.com/down" {
+			return nil, errors.New("connection refused")
+		}
+		return &spider.Response{StatusCode: 200, URL: req.URL, Body: []byte(req.URL)}, nil
+	})
+	page := &spider.Request{URL: "http://a.com/page", Method: "GET"}
+	missing := &spider.Request{URL: "http://a.com/missing", Method: "GET"}
+	down := &spider.Request{URL: "http://a.com/down", Method: "GET"}
+
+	// 录制模式总是发出请求
+	rec, err := New(dir, Record, 0)
+	assert.Nil(t, err)
+	f := rec.Middleware()(origin)
+	f.Get(page)
+	f.Get(page)
+	f.Get(missing)
+	f.Get(down)
+	assert.Equal(t, 4, calls)
+
+	// 重放模式不发出请求
+	replay, _ := New(dir, Replay, 0)
+	f = replay.Middleware()(origin)
+	resp, err := f.Get(page)
+	assert.Nil(t, err)
+	assert.Equal(t, "http://a.com/page", string(resp.Body))
+	_, err = f.Get(missing)
+	assert.Equal(t, 404, spider.StatusCode(err))
+	_, err = f.Get(down)
+	assert.ErrorIs(t, err, ErrMiss)
+	assert.Equal(t, 4, calls)
+
+	// 过期后重新请求
+	pass, _ := New(dir, Passthrough, time.Hour)
+	f = pass.Middleware()(origin)
+	f.Get(page)
+	assert.Equal(t, 4, calls)
+	pass.TTL = time.Nanosecond
+	f.Get(page)
+	assert.Equal(t, 5, calls)
+
+	_, err = New(dir, "unknown", 0)
+	assert.NotNil(t, err)
+}
+
+func TestCache_SkipBanned(t *testing.T) {
+	task := &spider.Task{Options: spider.Options{Validate: map[string]*spider.Validation{
+		"page": {BanStatus: []int{403}, BanPatterns: []string{"captcha"}, Required: []string{"title"}},
+	}}}
+	origin := spider.FetchFunc(func(req *spider.Request) (*spider.Response, error) {
+		switch req.URL {
+		case "http://a.com/forbidden":
+			return nil, &spider.StatusError{Code: 403}
+		case "http://a.com/limited":
+			return nil, &spider.StatusError{Code: 429, Response: &spider.Response{StatusCode: 429, Body: []byte("captcha")}}
+		case "http://a.com/captcha":
+			return &spider.Response{StatusCode: 200, URL: req.URL, Body: []byte("captcha")}, nil
+		case "http://a.com/empty":
+			return &spider.Response{StatusCode: 200, URL: req.URL, Body: []byte("empty")}, nil
+		}
+		return &spider.Response{StatusCode: 200, URL: req.URL, Body: []byte("title")}, nil
+	})
+
+	c, err := New(t.TempDir(), Record, 0)
+	assert.Nil(t, err)
+	f := c.Middleware()(origin)
+	get := func(u string) *spider.Request {
+		req := &spider.Request{Task: task, URL: u, Method: "GET", RuleName: "page"}
+		f.Get(req)
+		return req
+	}
+	// 封禁页面与未通过校验的页面不保存
+	for _, u := range []string{"http://a.com/forbidden", "http://a.com/limited", "http://a.com/captcha", "http://a.com/empty"} {
+		_, err := c.Get(get(u))
+		assert.ErrorIs(t, err, ErrMiss, u)
+	}
+	resp, err := c.Get(get("http://a.com/page"))
+	assert.Nil(t, err)
+	assert.Equal(t, "title", string(resp.Body))
+}
+
+func TestCache_Parse(t *testing.T) {
+	origin := spider.FetchFunc(func(req *spider.Request) (*spider.Response, error) {
+		body := `<html><body><h1>小王子</h1><a class="next" href="/list?page=2">next</a></body></html>`
+		return &spider.Response{StatusCode: 200, URL: req.URL, Body: []byte(body)}, nil
+	})
+	c, err := New(t.TempDir(), Record, 0)
+	assert.Nil(t, err)
+	task := &spider.Task{Options: spider.Options{Name: "book"}}
+	task.Rule.Trunk = map[string]*spider.Rule{
+		// 只使用提取规则与分页规则，没有解析函数
+		"list": {
+			Extract:  &spider.Extraction{Fields: []spider.Field{{Name: "title", CSS: "h1"}}},
+			Paginate: &spider.Pagination{Next: "a.next"},
+		},
+	}
+	req := &spider.Request{Task: task, URL: "http://a.com/list", Method: "GET", RuleName: "list"}
+	_, err = c.Middleware()(origin).Get(req)
+	assert.Nil(t, err)
+
+	result, err := c.Parse(req)
+	assert.Nil(t, err)
+	assert.Len(t, result.Items, 1)
+	assert.Equal(t, map[string]interface{}{"title": "小王子"}, result.Items[0].(*spider.DataCell).Data)
+	assert.Len(t, result.Requesrts, 1)
+	assert.Equal(t, "http://a.com/list?page=2", result.Requesrts[0].URL)
+
+	_, err = c.Parse(&spider.Request{Task: task, URL: "http://a.com/list", Method: "GET", RuleName: "missing"})
+	assert.NotNil(t, err)
+}
@@ -2,7 +2,9 @@ package cmd
 
 import (
 	"github.com/spf13/cobra"
+	"gocrawler/cmd/deadletter"
 	"gocrawler/cmd/master"
+	"gocrawler/cmd/task"
 	"gocrawler/cmd/worker"
 	"gocrawler/version"
 )
@@ -29,6 +31,6 @@ var versionCmd = &cobra.Command{
 
 func Execute() {
 	var rootCmd = &cobra.Command{Use: "crawler"}
-	rootCmd.AddCommand(masterCmd, worker.WorkerCmd, versionCmd)
+	rootCmd.AddCommand(masterCmd, worker.WorkerCmd, deadletter.DeadLetterCmd, task.TaskCmd, versionCmd)
 	rootCmd.Execute()
 }
@@ -0,0 +1,122 @@
+package deadletter
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"gocrawler/deadletter"
+	"os"
+	"regexp"
+	"text/tabwriter"
+	"time"
+)
+
+var DeadLetterCmd = &cobra.Command{
+	Use:   "deadletter",
+	Short: "inspect and redrive failed requests.",
+	Long:  "inspect and redrive failed requests.",
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "list failed requests.",
+	Long:  "list failed requests.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return List()
+	},
+}
+
+var redriveCmd = &cobra.Command{
+	Use:   "redrive",
+	Short: "replay failed requests in running or next started workers.",
+	Long:  "move matched failed requests to the redrive queue, running workers pick them up periodically, otherwise they are replayed on next start.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return Redrive()
+	},
+}
+
+var (
+	dir      string
+	taskName string
+	ruleName string
+	urlRe    string
+)
+
+func init() {
+	DeadLetterCmd.PersistentFlags().StringVar(
+		&dir, "dir", "data/deadletter", "set dead letter directory")
+	DeadLetterCmd.PersistentFlags().StringVar(
+		&taskName, "task", "", "filter by task name")
+	DeadLetterCmd.PersistentFlags().StringVar(
+		&ruleName, "rule", "", "filter by rule name")
+	DeadLetterCmd.PersistentFlags().StringVar(
+		&urlRe, "url", "", "filter by url regexp")
+	DeadLetterCmd.AddCommand(listCmd, redriveCmd)
+}
+
+func List() error {
+	q, err := deadletter.New(dir)
+	if err != nil {
+		return err
+	}
+	entries, err := q.List()
+	if err != nil {
+		return err
+	}
+	match, err := matcher()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tTASK\tRULE\tATTEMPTS\tSTATUS\tURL\tERROR")
+	for _, e := range entries {
+		if !match(e) {
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%s\t%s\n",
+			e.Time.Format(time.DateTime), e.Request.TaskName, e.Request.RuleName,
+			e.Attempts, e.StatusCode, e.Request.URL, e.Error)
+	}
+	return w.Flush()
+}
+
+func Redrive() error {
+	q, err := deadletter.New(dir)
+	if err != nil {
+		return err
+	}
+	match, err := matcher()
+	if err != nil {
+		return err
+	}
+	n, err := q.Redrive(match)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d requests moved to redrive queue\n", n)
+	return nil
+}
+
+func matcher() (func(deadletter.Entry) bool, error) {
+	var re *regexp.Regexp
+	if urlRe != "" {
+		var err error
+		if re, err = regexp.Compile(urlRe); err != nil {
+			return nil, err
+		}
+	}
+	return func(e deadletter.Entry) bool {
+		if taskName != "" && e.Request.TaskName != taskName {
+			return false
+		}
+		if ruleName != "" && e.Request.RuleName != ruleName {
+			return false
+		}
+		if re != nil && !re.MatchString(e.Request.URL) {
+			return false
+		}
+		return true
+	}, nil
+}
@@ -0,0 +1,103 @@
+package task
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	"gocrawler/engine"
+	"net/http"
+	"net/url"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+var TaskCmd = &cobra.Command{
+	Use:   "task",
+	Short: "show and control worker tasks.",
+	Long:  "show and control worker tasks.",
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "print task states.",
+	Long:  "print task states.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return Status()
+	},
+}
+
+var pauseCmd = &cobra.Command{
+	Use:   "pause [task name]",
+	Short: "pause a running task.",
+	Long:  "pause a running task.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return post(args[0], "pause")
+	},
+}
+
+var resumeCmd = &cobra.Command{
+	Use:   "resume [task name]",
+	Short: "resume a paused task.",
+	Long:  "resume a paused task.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return post(args[0], "resume")
+	},
+}
+
+var workerAddress string
+
+func init() {
+	TaskCmd.PersistentFlags().StringVar(
+		&workerAddress, "addr", "http://127.0.0.1:8080", "set worker HTTP address")
+	TaskCmd.AddCommand(statusCmd, pauseCmd, resumeCmd)
+}
+
+func Status() error {
+	resp, err := http.Get(workerAddress + "/tasks")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("error status code:%d", resp.StatusCode)
+	}
+
+	var status []engine.TaskStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TASK\tSTATE\tOUTSTANDING\tSUCCEEDED\tFAILED\tBLOCKED\tUNCHANGED\tSKIPPED\tINVALID\tBANNED\tSTART\tEND")
+	for _, s := range status {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%s\t%s\n",
+			s.Name, s.State, s.Outstanding, s.Succeeded, s.Failed, s.Blocked, s.Unchanged, s.Skipped, s.Invalid, s.Banned, formatTime(s.StartTime), formatTime(s.EndTime))
+	}
+	return w.Flush()
+}
+
+func post(name string, action string) error {
+	resp, err := http.Post(workerAddress+"/tasks/"+url.PathEscape(name)+"/"+action, "application/json", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var body map[string]string
+		json.NewDecoder(resp.Body).Decode(&body)
+		return fmt.Errorf("%s task failed:%s", action, body["error"])
+	}
+	fmt.Printf("task %s %sd\n", name, action)
+	return nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format(time.DateTime)
+}
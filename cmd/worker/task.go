@@ -0,0 +1,48 @@
+package worker
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"gocrawler/engine"
+	"net/http"
+)
+
+// 注册任务状态接口
+// GET /tasks 查看所有任务的状态
+// POST /tasks/{name}/pause 暂停任务
+// POST /tasks/{name}/resume 恢复任务
+func RegisterTaskHandler(mux *runtime.ServeMux, s *engine.Crawler) error {
+	if err := mux.HandlePath(http.MethodGet, "/tasks", func(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+		writeJSON(w, http.StatusOK, s.TaskStatus())
+	}); err != nil {
+		return err
+	}
+
+	if err := mux.HandlePath(http.MethodPost, "/tasks/{name}/pause", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		writeTaskResult(w, s.PauseTask(params["name"]))
+	}); err != nil {
+		return err
+	}
+
+	return mux.HandlePath(http.MethodPost, "/tasks/{name}/resume", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		writeTaskResult(w, s.ResumeTask(params["name"]))
+	})
+}
+
+func writeTaskResult(w http.ResponseWriter, err error) {
+	switch {
+	case err == nil:
+		writeJSON(w, http.StatusOK, map[string]string{})
+	case errors.Is(err, engine.ErrTaskNotFound):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+	default:
+		writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
@@ -2,6 +2,7 @@ package worker
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/go-micro/plugins/v4/config/encoder/toml"
 	"github.com/go-micro/plugins/v4/registry/etcd"
@@ -20,19 +21,27 @@ import (
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"gocrawler/collect"
+	"gocrawler/deadletter"
+	"gocrawler/dedup"
 	"gocrawler/engine"
 	"gocrawler/generator"
 	"gocrawler/limiter"
 	"gocrawler/log"
 	"gocrawler/proto/greeter"
 	"gocrawler/proxy"
+	"gocrawler/revisit"
+	"gocrawler/robots"
+	"gocrawler/session"
 	"gocrawler/spider"
 	"gocrawler/storage/sqlstorage"
 	"golang.org/x/time/rate"
 	grpc2 "google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 	"net/http"
+	"os/signal"
+	"path/filepath"
 	"strconv"
+	"syscall"
 	"time"
 )
 
@@ -80,7 +89,6 @@ func Run() {
 	var (
 		err     error
 		logger  *zap.Logger
-		p       proxy.Func
 		storage spider.Storage
 	)
 
@@ -110,17 +118,34 @@ func Run() {
 	zap.ReplaceGlobals(logger)
 
 	// fetcher
-	proxyURLs := cfg.Get("fetcher", "proxy").StringSlice([]string{})
-	timeout := cfg.Get("fetcher", "timeout").Int(5000)
-	logger.Sugar().Info("proxy list: ", proxyURLs, " timeout: ", timeout)
-	if p, err = proxy.RoundRobinProxySwitcher(proxyURLs...); err != nil {
-		logger.Error("RoundRobinProxySwitcher failed", zap.Error(err))
+	var fcfg FetcherConfig
+	if err := cfg.Get("fetcher").Scan(&fcfg); err != nil {
+		logger.Error("get fetcher config failed", zap.Error(err))
+		return
+	}
+	proxies, err := NewProxyPool(cfg, logger.Named("proxy"))
+	if err != nil {
+		logger.Error("create proxy pool failed", zap.Error(err))
+		return
 	}
-	var f spider.Fetcher = &collect.BrowserFetch{
-		Timeout: time.Duration(timeout) * time.Millisecond,
-		Logger:  logger,
-		Proxy:   p,
+	bf := &collect.BrowserFetch{
+		Timeout:     fcfg.TimeoutDuration(),
+		Logger:      logger,
+		Transport:   fcfg.Transport(),
+		MaxBodySize: fcfg.MaxBodySize,
 	}
+	if proxies != nil {
+		bf.Proxy = proxies.Func()
+	}
+	var f spider.Fetcher = bf
+
+	// 无头浏览器，只有任务使用 chrome Fetcher 时才会启动
+	browser := &collect.Browser{
+		ExecPath: cfg.Get("browser", "execPath").String(""),
+		Proxy:    cfg.Get("browser", "proxy").String(""),
+		Logger:   logger.Named("browser"),
+	}
+	defer browser.Close()
 
 	// storage
 	sqlURL := cfg.Get("storage", "sqlURL").String("")
@@ -133,12 +158,39 @@ func Run() {
 		return
 	}
 
+	// deduper
+	deduper, err := NewDeduper(cfg)
+	if err != nil {
+		logger.Error("create deduper failed", zap.Error(err))
+		return
+	}
+
+	// revisit store
+	revisitStore, err := NewRevisitStore(cfg)
+	if err != nil {
+		logger.Error("create revisit store failed", zap.Error(err))
+		return
+	}
+
+	// dead letter queue
+	deadLetter, err := deadletter.New(cfg.Get("deadletter", "dir").String("data/deadletter"))
+	if err != nil {
+		logger.Error("create dead letter queue failed", zap.Error(err))
+		return
+	}
+
 	// init tasks
 	var tcfg []spider.TaskConfig
 	if err := cfg.Get("Tasks").Scan(&tcfg); err != nil {
 		logger.Error("init seed tasks", zap.Error(err))
 	}
-	seeds := ParseTaskConfig(logger, f, storage, tcfg)
+	seeds := ParseTaskConfig(logger, f, browser, proxies, storage, tcfg)
+
+	scheduler, err := NewScheduler(cfg, logger.Named("scheduler"), seeds)
+	if err != nil {
+		logger.Error("create scheduler failed", zap.Error(err))
+		return
+	}
 
 	var sconfig ServerConfig
 	if err := cfg.Get("GRPCServer").Scan(&sconfig); err != nil {
@@ -146,14 +198,18 @@ func Run() {
 	}
 	logger.Sugar().Debugf("grpc server config,%+v", sconfig)
 
-	_ = engine.NewEngine(
+	s := engine.NewEngine(
 		engine.WithFetcher(f),
 		engine.WithLogger(logger),
 		engine.WithWorkCount(5),
 		engine.WithSeeds(seeds),
 		engine.WithregistryURL(sconfig.RegistryAddress),
-		engine.WithScheduler(engine.NewSchedule()),
+		engine.WithScheduler(scheduler),
 		engine.WithStorage(storage),
+		engine.WithDeduper(deduper),
+		engine.WithRevisitStore(revisitStore),
+		engine.WithDeadLetter(deadLetter),
+		engine.WithFrontierPath(cfg.Get("frontier", "snapshot").String("data/frontier.jsonl")),
 	)
 
 	if workerID == "" {
@@ -169,13 +225,26 @@ func Run() {
 	zap.S().Debug("worker id:", id)
 
 	// worker start
-	//go s.Run()
+	// 收到 SIGINT/SIGTERM 后停止爬虫，等待正在抓取的请求完成并保存剩余请求
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if proxies != nil {
+		go proxies.Run(ctx)
+	}
+	crawlerDone := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(crawlerDone)
+	}()
 
 	// start http proxy to GRPC
-	go RunHTTPServer(sconfig)
+	go RunHTTPServer(sconfig, s)
 
 	// start grpc server
 	RunGRPCServer(logger, sconfig)
+
+	stop()
+	<-crawlerDone
 }
 
 type ServerConfig struct {
@@ -226,7 +295,7 @@ func (g *Greeter) Hello(ctx context.Context, req *greeter.Request, rsp *greeter.
 	return nil
 }
 
-func RunHTTPServer(cfg ServerConfig) {
+func RunHTTPServer(cfg ServerConfig, s *engine.Crawler) {
 	ctx := context.Background()
 	ctx, cancel := context.WithCancel(ctx)
 
@@ -240,6 +309,9 @@ func RunHTTPServer(cfg ServerConfig) {
 	if err := greeter.RegisterGreeterGwFromEndpoint(ctx, mux, GRPCListenAddress, opts); err != nil {
 		zap.L().Fatal("Register backend grpc server endpoint failed")
 	}
+	if err := RegisterTaskHandler(mux, s); err != nil {
+		zap.L().Fatal("Register task handler failed")
+	}
 	zap.S().Debugf("start http server listening on %v proxy to grpc server;%v", HTTPListenAddress, GRPCListenAddress)
 	if err := http.ListenAndServe(HTTPListenAddress, mux); err != nil {
 		zap.L().Fatal("http listenAndServe failed")
@@ -263,7 +335,234 @@ func logWrapper(log *zap.Logger) server.HandlerWrapper {
 	}
 }
 
-func ParseTaskConfig(logger *zap.Logger, f spider.Fetcher, s spider.Storage, cfgs []spider.TaskConfig) []*spider.Task {
+// 根据 [scheduler] 配置创建调度器，type 可选 fifo、priority、disk
+// [politeness] 开启时，在调度器外层按域名限制抓取频率
+func NewScheduler(cfg config.Config, logger *zap.Logger, seeds []*spider.Task) (engine.Scheduler, error) {
+	var s engine.Scheduler
+	switch typ := cfg.Get("scheduler", "type").String("priority"); typ {
+	case "fifo":
+		s = engine.NewSchedule()
+	case "priority":
+		s = engine.NewPrioritySchedule()
+	case "disk":
+		ds, err := engine.NewDiskSchedule(
+			cfg.Get("scheduler", "dir").String("data/frontier"),
+			cfg.Get("scheduler", "watermark").Int(10000),
+			seeds,
+		)
+		if err != nil {
+			return nil, err
+		}
+		ds.Logger = logger
+		s = ds
+	default:
+		return nil, fmt.Errorf("unknown scheduler type:%s", typ)
+	}
+
+	var pcfg PolitenessConfig
+	if err := cfg.Get("politeness").Scan(&pcfg); err != nil {
+		return nil, err
+	}
+	if !pcfg.Enable {
+		for _, task := range seeds {
+			if _, ok := task.Robots.(spider.CrawlDelayer); ok {
+				logger.Warn("politeness disabled, robots.txt Crawl-delay is ignored", zap.String("task", task.Name))
+			}
+		}
+		return s, nil
+	}
+	// 请求间隔由调度器控制，不再在 worker 中随机休眠
+	for _, task := range seeds {
+		task.WaitTime = 0
+	}
+	overrides := make(map[string]engine.HostPolicy, len(pcfg.Hosts))
+	for _, h := range pcfg.Hosts {
+		overrides[h.Host] = h.Policy()
+	}
+	return engine.NewPoliteSchedule(s, pcfg.Policy(), overrides), nil
+}
+
+// [fetcher] 配置，时间单位都是毫秒
+type FetcherConfig struct {
+	Timeout               int
+	MaxBodySize           int64 // 字节
+	MaxIdleConns          int
+	MaxIdleConnsPerHost   int
+	MaxConnsPerHost       int
+	IdleConnTimeout       int
+	DialTimeout           int
+	TLSHandshakeTimeout   int
+	ResponseHeaderTimeout int
+	DisableHTTP2          bool
+	InsecureSkipVerify    bool
+	TLSMinVersion         string
+}
+
+func (c FetcherConfig) TimeoutDuration() time.Duration {
+	if c.Timeout <= 0 {
+		return 5 * time.Second
+	}
+	return time.Duration(c.Timeout) * time.Millisecond
+}
+
+func (c FetcherConfig) Transport() collect.TransportConfig {
+	ms := func(v int) time.Duration {
+		return time.Duration(v) * time.Millisecond
+	}
+	return collect.TransportConfig{
+		MaxIdleConns:          c.MaxIdleConns,
+		MaxIdleConnsPerHost:   c.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       c.MaxConnsPerHost,
+		IdleConnTimeout:       ms(c.IdleConnTimeout),
+		DialTimeout:           ms(c.DialTimeout),
+		TLSHandshakeTimeout:   ms(c.TLSHandshakeTimeout),
+		ResponseHeaderTimeout: ms(c.ResponseHeaderTimeout),
+		DisableHTTP2:          c.DisableHTTP2,
+		InsecureSkipVerify:    c.InsecureSkipVerify,
+		TLSMinVersion:         c.TLSMinVersion,
+	}
+}
+
+type PolitenessConfig struct {
+	Enable bool
+	HostConfig
+	Hosts []HostConfig
+}
+
+type HostConfig struct {
+	Host     string
+	MaxConns int
+	MinDelay int // 毫秒
+	Jitter   int // 毫秒
+	MaxQueue int // 最多暂存的请求数量
+}
+
+func (c HostConfig) Policy() engine.HostPolicy {
+	return engine.HostPolicy{
+		MaxConns: c.MaxConns,
+		MinDelay: time.Duration(c.MinDelay) * time.Millisecond,
+		Jitter:   time.Duration(c.Jitter) * time.Millisecond,
+		MaxQueue: c.MaxQueue,
+	}
+}
+
+// 根据 [dedup] 配置创建去重器，type 可选 memory、file、bloom
+func NewDeduper(cfg config.Config) (dedup.Deduper, error) {
+	switch typ := cfg.Get("dedup", "type").String("memory"); typ {
+	case "memory":
+		return dedup.NewMemory(), nil
+	case "file":
+		return dedup.NewFile(cfg.Get("dedup", "path").String("data/visited.log"))
+	case "bloom":
+		return dedup.NewBloom(
+			uint64(cfg.Get("dedup", "capacity").Int(10000000)),
+			cfg.Get("dedup", "falsePositive").Float64(0.001),
+		)
+	default:
+		return nil, fmt.Errorf("unknown dedup type:%s", typ)
+	}
+}
+
+// 根据 [revisit] 配置创建保存 ETag、Last-Modified 的存储，type 可选 memory、file
+func NewRevisitStore(cfg config.Config) (revisit.Store, error) {
+	switch typ := cfg.Get("revisit", "type").String("memory"); typ {
+	case "memory":
+		return revisit.NewMemory(), nil
+	case "file":
+		return revisit.NewFile(cfg.Get("revisit", "path").String("data/revisit.log"))
+	default:
+		return nil, fmt.Errorf("unknown revisit type:%s", typ)
+	}
+}
+
+func NewRobotsChecker(logger *zap.Logger, cfg spider.RobotsConfig) *robots.Checker {
+	agent := cfg.UserAgent
+	if agent == "" {
+		agent = "gocrawler"
+	}
+	ttl := 24 * time.Hour
+	if cfg.TTL > 0 {
+		ttl = time.Duration(cfg.TTL) * time.Second
+	}
+	r := robots.NewChecker(agent, ttl)
+	r.Logger = logger
+	return r
+}
+
+// 任务的会话池，任务的 Cookie 作为名为 default 的账号
+func NewSessionPool(logger *zap.Logger, cfg spider.TaskConfig) (*session.Pool, error) {
+	sc := cfg.Sessions
+	path := sc.Path
+	if path == "" {
+		path = filepath.Join("data", "sessions", cfg.Name+".json")
+	}
+	p, err := session.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	p.Logger = logger
+	if sc.Cooldown > 0 {
+		p.Cooldown = time.Duration(sc.Cooldown) * time.Second
+	}
+	accounts := sc.Accounts
+	if len(accounts) == 0 && cfg.Cookie != "" {
+		accounts = []spider.AccountConfig{{ID: "default", Cookie: cfg.Cookie}}
+	}
+	for _, a := range accounts {
+		if sc.Domain == "" {
+			return nil, errors.New("sessions domain is required for account cookies")
+		}
+		if err := p.Add(a.ID, a.Cookie, sc.Domain); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// 代理池，[proxy] source 为代理列表的文件或地址，为空时使用 [fetcher] proxy
+// 没有配置任何代理时返回 nil，直接访问网站
+func NewProxyPool(cfg config.Config, logger *zap.Logger) (*proxy.Pool, error) {
+	p := proxy.NewPool()
+	p.Logger = logger
+	p.Strategy = proxy.Strategy(cfg.Get("proxy", "strategy").String(string(proxy.Weighted)))
+	if n := cfg.Get("proxy", "maxFailures").Int(0); n > 0 {
+		p.MaxFailures = n
+	}
+	if sec := cfg.Get("proxy", "quarantine").Int(0); sec > 0 {
+		p.Quarantine = time.Duration(sec) * time.Second
+	}
+	if sec := cfg.Get("proxy", "probeInterval").Int(0); sec > 0 {
+		p.ProbeInterval = time.Duration(sec) * time.Second
+	}
+	if sec := cfg.Get("proxy", "reloadInterval").Int(0); sec > 0 {
+		p.ReloadInterval = time.Duration(sec) * time.Second
+	}
+	p.Affinity = proxy.Affinity(cfg.Get("proxy", "affinity").String(""))
+	if sec := cfg.Get("proxy", "stickyTTL").Int(-1); sec >= 0 {
+		p.StickyTTL = time.Duration(sec) * time.Second
+	}
+	p.ProbeURL = cfg.Get("proxy", "probeURL").String("")
+	p.Source = cfg.Get("proxy", "source").String("")
+
+	if p.Source != "" {
+		if err := p.Reload(context.Background()); err != nil {
+			return nil, fmt.Errorf("load proxy list failed:%w", err)
+		}
+	} else if err := p.Update(cfg.Get("fetcher", "proxy").StringSlice([]string{})); err != nil {
+		return nil, err
+	}
+	if p.Len() == 0 {
+		logger.Info("no proxy configured")
+		return nil, nil
+	}
+	logger.Info("proxy pool loaded",
+		zap.Int("count", p.Len()),
+		zap.String("strategy", string(p.Strategy)),
+		zap.String("affinity", string(p.Affinity)))
+	return p, nil
+}
+
+func ParseTaskConfig(logger *zap.Logger, f spider.Fetcher, b *collect.Browser, proxies *proxy.Pool, s spider.Storage, cfgs []spider.TaskConfig) []*spider.Task {
 	tasks := make([]*spider.Task, 0, 1000)
 	for _, cfg := range cfgs {
 		t := spider.NewTask(
@@ -282,6 +581,26 @@ func ParseTaskConfig(logger *zap.Logger, f spider.Fetcher, s spider.Storage, cfg
 			t.MaxDepth = cfg.MaxDepth
 		}
 
+		if cfg.Weight > 0 {
+			t.Weight = cfg.Weight
+		}
+
+		if cfg.Retry.MaxAttempts > 0 {
+			t.Retry.MaxAttempts = cfg.Retry.MaxAttempts
+		}
+		if cfg.Retry.BaseDelay > 0 {
+			t.Retry.BaseDelay = time.Duration(cfg.Retry.BaseDelay) * time.Millisecond
+		}
+		if cfg.Retry.MaxDelay > 0 {
+			t.Retry.MaxDelay = time.Duration(cfg.Retry.MaxDelay) * time.Millisecond
+		}
+		if len(cfg.Retry.RetryOn) > 0 {
+			t.Retry.RetryOn = cfg.Retry.RetryOn
+		}
+		if len(cfg.Retry.GiveUpOn) > 0 {
+			t.Retry.GiveUpOn = cfg.Retry.GiveUpOn
+		}
+
 		var limits []limiter.RateLimiter
 		if len(cfg.Limits) > 0 {
 			for _, lcfg := range cfg.Limits {
@@ -289,13 +608,80 @@ func ParseTaskConfig(logger *zap.Logger, f spider.Fetcher, s spider.Storage, cfg
 				l := rate.NewLimiter(limiter.Per(lcfg.EventCount, time.Duration(lcfg.EventDur)*time.Second), 1)
 				limits = append(limits, l)
 			}
+		}
+
+		if len(cfg.Validate) > 0 {
+			t.Validate = cfg.Validate
+		}
+		// 预设任务的规则在引擎启动时才会关联到任务上，这里提前检查
+		if preset, ok := engine.Store.Hash[cfg.Name]; ok {
+			t.Rule = preset.Rule
+		}
+		if err := t.Compile(); err != nil {
+			logger.Error("invalid task rules, skip task", zap.String("task", cfg.Name), zap.Error(err))
+			continue
+		}
+
+		if len(cfg.Revisit) > 0 {
+			t.Revisit = make(map[string]time.Duration, len(cfg.Revisit))
+			for rule, sec := range cfg.Revisit {
+				t.Revisit[rule] = time.Duration(sec) * time.Second
+			}
+		}
+
+		if cfg.Robots.Enable {
+			r := NewRobotsChecker(logger, cfg.Robots)
+			// Crawl-delay 由 PoliteSchedule 按域名生效
+			t.Robots = r
+		}
+
+		if len(limits) > 0 {
 			multiLimiter := limiter.Multi(limits...)
 			t.Limit = multiLimiter
 		}
 
 		switch cfg.Fetcher {
 		case "browser":
-			t.Fetcher = f
+			t.Fetcher = spider.Chain(f, collect.DefaultUA())
+			if proxies != nil {
+				t.Fetcher = spider.Chain(t.Fetcher, proxies.Middleware())
+				t.OnBan = append(t.OnBan, proxies.OnBan)
+			}
+		case "chrome":
+			t.Fetcher = &collect.ChromeFetch{
+				Browser:      b,
+				Timeout:      time.Duration(cfg.Browser.Timeout) * time.Millisecond,
+				WaitSelector: cfg.Browser.WaitSelector,
+				WaitIdle:     time.Duration(cfg.Browser.WaitIdle) * time.Millisecond,
+				Screenshot:   cfg.Browser.Screenshot,
+			}
+		}
+
+		if t.Fetcher != nil {
+			t.Fetcher = spider.Chain(t.Fetcher, collect.TaskCookie())
+		}
+
+		if len(cfg.Middlewares) > 0 && t.Fetcher != nil {
+			mws, err := spider.NewMiddlewares(cfg.Middlewares)
+			if err != nil {
+				// 缺少中间件时任务的请求可能没有认证或签名，不启动该任务
+				logger.Error("create fetcher middlewares failed, skip task", zap.String("task", cfg.Name), zap.Error(err))
+				continue
+			}
+			t.Fetcher = spider.Chain(t.Fetcher, mws...)
+		}
+
+		if cfg.Sessions.Enable && t.Fetcher != nil {
+			p, err := NewSessionPool(logger, cfg)
+			if err != nil {
+				// 不能退回到任务的静态 Cookie，否则会用错误的账号抓取
+				logger.Error("create session pool failed, skip task", zap.String("task", cfg.Name), zap.Error(err))
+				continue
+			}
+			// 会话池接管任务的 Cookie
+			t.Cookie = ""
+			t.Fetcher = spider.Chain(t.Fetcher, p.Middleware())
+			t.OnBan = append(t.OnBan, p.OnBan)
 		}
 		tasks = append(tasks, t)
 	}
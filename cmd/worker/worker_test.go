@@ -0,0 +1,45 @@
+package worker
+
+import (
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"gocrawler/proxy"
+	"gocrawler/spider"
+	"net/url"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseTaskConfig_ProxyBan(t *testing.T) {
+	proxies := proxy.NewPool()
+	assert.Nil(t, proxies.Update([]string{"http://127.0.0.1:7890"}))
+	f := spider.FetchFunc(func(req *spider.Request) (*spider.Response, error) {
+		return nil, &spider.StatusError{Code: 403}
+	})
+	tasks := ParseTaskConfig(zap.NewNop(), f, nil, proxies, nil, []spider.TaskConfig{{
+		Name:        "proxy_ban",
+		Cookie:      "sid=1",
+		Fetcher:     "browser",
+		Middlewares: []spider.MiddlewareConfig{{Name: "header", Args: map[string]string{"Referer": "http://a.com/"}}},
+		Sessions: spider.SessionConfig{
+			Enable: true,
+			Path:   filepath.Join(t.TempDir(), "sessions.json"),
+			Domain: "a.com",
+		},
+	}})
+	assert.Len(t, tasks, 1)
+	task := tasks[0]
+
+	// 经过任务的全部中间件后，引擎持有的请求上仍能找到使用的代理与会话
+	req := &spider.Request{Task: task, URL: "http://a.com/page", Method: "GET"}
+	_, err := task.Fetcher.Get(req)
+	assert.Equal(t, 403, spider.StatusCode(err))
+	assert.Equal(t, "http://127.0.0.1:7890", req.Proxy)
+	assert.Equal(t, "default", req.Session)
+
+	for _, ban := range task.OnBan {
+		ban(req, nil)
+	}
+	u, _ := url.Parse(req.Proxy)
+	assert.False(t, proxies.Available(u))
+}
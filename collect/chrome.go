@@ -0,0 +1,298 @@
+package collect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/emulation"
+	"github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+	"go.uber.org/zap"
+	"gocrawler/spider"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Browser 本地的无头 Chromium 进程，第一次抓取时启动，多个任务共享
+type Browser struct {
+	ExecPath string // 为空时在 PATH 中查找 chromium、google-chrome 等
+	Proxy    string // 浏览器使用的代理，例如 http://127.0.0.1:7890
+	Logger   *zap.Logger
+
+	lock   sync.Mutex
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// 启动浏览器，浏览器进程退出后下一次调用会重新启动
+func (b *Browser) start() (context.Context, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.ctx != nil && b.ctx.Err() == nil {
+		return b.ctx, nil
+	}
+	opts := append(chromedp.DefaultExecAllocatorOptions[:], chromedp.NoSandbox)
+	if b.ExecPath != "" {
+		opts = append(opts, chromedp.ExecPath(b.ExecPath))
+	}
+	if b.Proxy != "" {
+		opts = append(opts, chromedp.ProxyServer(b.Proxy))
+	}
+	allocCtx, allocCancel := chromedp.NewExecAllocator(context.Background(), opts...)
+	ctx, cancel := chromedp.NewContext(allocCtx)
+	// 先打开一个空白页启动浏览器，之后每个请求在新的标签页中打开
+	if err := chromedp.Run(ctx); err != nil {
+		cancel()
+		allocCancel()
+		return nil, fmt.Errorf("start browser failed:%w", err)
+	}
+	b.ctx = ctx
+	b.cancel = func() {
+		cancel()
+		allocCancel()
+	}
+	if b.Logger != nil {
+		b.Logger.Info("browser started")
+	}
+	return b.ctx, nil
+}
+
+// 关闭浏览器进程
+func (b *Browser) Close() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.cancel != nil {
+		b.cancel()
+	}
+}
+
+// 没有设置 ChromeFetch.Timeout 时单个页面的超时时间
+const DefaultChromeTimeout = time.Minute
+
+// ChromeFetch 使用无头浏览器执行页面中的 JavaScript，返回渲染后的 DOM
+// 只支持 GET 请求，每个页面在独立的浏览器上下文中打开，不共享 Cookie；
+// Cookie 只对请求的地址生效，其他请求头只附加到同一主机的文档请求上，不会发送给第三方资源
+type ChromeFetch struct {
+	Browser      *Browser
+	Timeout      time.Duration // 单个页面的超时时间，包括等待条件，为 0 时使用 DefaultChromeTimeout
+	WaitSelector string        // 页面加载后等待该 CSS 选择器出现
+	WaitIdle     time.Duration // 页面加载后等待网络空闲的时间，为 0 时不等待
+	Screenshot   bool          // 截取整个页面，保存在 Response.Screenshot 中
+}
+
+func (c *ChromeFetch) Get(request *spider.Request) (*spider.Response, error) {
+	if m := request.HTTPMethod(); m != http.MethodGet {
+		return nil, fmt.Errorf("browser fetcher does not support method %s", m)
+	}
+	browserCtx, err := c.Browser.start()
+	if err != nil {
+		return nil, err
+	}
+	req, err := request.HTTPRequest()
+	if err != nil {
+		return nil, fmt.Errorf("get url failed:%v", err)
+	}
+
+	ctx, cancel := chromedp.NewContext(browserCtx, chromedp.WithNewBrowserContext())
+	defer cancel()
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultChromeTimeout
+	}
+	ctx, cancel = context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	events := newPageEvents()
+	chromedp.ListenTarget(ctx, func(ev interface{}) {
+		// 页面的主 frame 与 target 使用相同的 ID
+		events.handle(ev, cdp.FrameID(chromedp.FromContext(ctx).Target.TargetID))
+	})
+
+	start := time.Now()
+	// 浏览器自己处理缓存，不能使用条件请求头
+	req.Header.Del("If-None-Match")
+	req.Header.Del("If-Modified-Since")
+	if ua := req.Header.Get("User-Agent"); ua != "" {
+		req.Header.Del("User-Agent")
+		if err := chromedp.Run(ctx, emulation.SetUserAgentOverride(ua)); err != nil {
+			return nil, err
+		}
+	}
+	if cookies := req.Cookies(); len(cookies) > 0 {
+		req.Header.Del("Cookie")
+		params := make([]*network.CookieParam, 0, len(cookies))
+		for _, ck := range cookies {
+			params = append(params, &network.CookieParam{Name: ck.Name, Value: ck.Value, URL: req.URL.String()})
+		}
+		if err := chromedp.Run(ctx, network.SetCookies(params)); err != nil {
+			return nil, err
+		}
+	}
+	if len(req.Header) > 0 {
+		if err := documentHeaders(ctx, req.URL, req.Header); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := chromedp.RunResponse(ctx, chromedp.Navigate(req.URL.String()))
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, errors.New("browser returned no response")
+	}
+	if resp.Status == http.StatusNotModified {
+		return nil, spider.ErrNotModified
+	}
+	if resp.Status != http.StatusOK {
+		// 错误页面同样带上响应头与内容，用于识别封禁页面与 Retry-After
+		var html string
+		_ = chromedp.Run(ctx, chromedp.OuterHTML("html", &html, chromedp.ByQuery))
+		return nil, &spider.StatusError{Code: int(resp.Status), Response: &spider.Response{
+			StatusCode: int(resp.Status),
+			Header:     responseHeader(resp.Headers),
+			URL:        resp.URL,
+			Charset:    "utf-8",
+			Elapsed:    time.Since(start),
+			Body:       []byte(html),
+		}}
+	}
+
+	var actions []chromedp.Action
+	if c.WaitSelector != "" {
+		actions = append(actions, chromedp.WaitReady(c.WaitSelector, chromedp.ByQuery))
+	}
+	if c.WaitIdle > 0 {
+		actions = append(actions, chromedp.ActionFunc(func(ctx context.Context) error {
+			ticker := time.NewTicker(50 * time.Millisecond)
+			defer ticker.Stop()
+			for {
+				if events.idle(c.WaitIdle) {
+					return nil
+				}
+				select {
+				case <-ticker.C:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		}))
+	}
+	var html, location string
+	var screenshot []byte
+	actions = append(actions,
+		chromedp.OuterHTML("html", &html, chromedp.ByQuery),
+		chromedp.Location(&location),
+	)
+	if c.Screenshot {
+		actions = append(actions, chromedp.FullScreenshot(&screenshot, 100))
+	}
+	if err := chromedp.Run(ctx, actions...); err != nil {
+		return nil, err
+	}
+
+	return &spider.Response{
+		StatusCode: int(resp.Status),
+		Header:     responseHeader(resp.Headers),
+		URL:        location,
+		Redirects:  events.redirectURLs(),
+		Charset:    "utf-8",
+		Elapsed:    time.Since(start),
+		Body:       []byte(html),
+		Screenshot: screenshot,
+	}, nil
+}
+
+// 记录主文档的重定向与正在进行的网络请求
+type pageEvents struct {
+	inflight  int64
+	lastEvent atomic.Value
+	redirects []string
+	lock      sync.Mutex
+}
+
+func newPageEvents() *pageEvents {
+	e := &pageEvents{}
+	e.lastEvent.Store(time.Now())
+	return e
+}
+
+func (e *pageEvents) handle(ev interface{}, mainFrame cdp.FrameID) {
+	switch ev := ev.(type) {
+	case *network.EventRequestWillBeSent:
+		// 重定向沿用同一个 RequestID，不再重复计数
+		if ev.RedirectResponse == nil {
+			atomic.AddInt64(&e.inflight, 1)
+		} else if ev.Type == network.ResourceTypeDocument && ev.FrameID == mainFrame {
+			e.lock.Lock()
+			e.redirects = append(e.redirects, ev.RedirectResponse.URL)
+			e.lock.Unlock()
+		}
+	case *network.EventLoadingFinished, *network.EventLoadingFailed:
+		atomic.AddInt64(&e.inflight, -1)
+	default:
+		return
+	}
+	e.lastEvent.Store(time.Now())
+}
+
+// 没有正在进行的网络请求，且距离上一个网络事件已经超过 d
+func (e *pageEvents) idle(d time.Duration) bool {
+	return atomic.LoadInt64(&e.inflight) <= 0 && time.Since(e.lastEvent.Load().(time.Time)) >= d
+}
+
+func (e *pageEvents) redirectURLs() []string {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return append([]string(nil), e.redirects...)
+}
+
+func responseHeader(headers network.Headers) http.Header {
+	header := http.Header{}
+	for k, v := range headers {
+		header.Set(k, fmt.Sprint(v))
+	}
+	return header
+}
+
+// 拦截文档请求，只为与 u 同一主机的文档请求添加请求头，例如主文档及其重定向
+func documentHeaders(ctx context.Context, u *url.URL, header http.Header) error {
+	chromedp.ListenTarget(ctx, func(ev interface{}) {
+		paused, ok := ev.(*fetch.EventRequestPaused)
+		if !ok {
+			return
+		}
+		// 事件处理函数中不能直接执行命令
+		go func() {
+			params := fetch.ContinueRequest(paused.RequestID)
+			if target, err := url.Parse(paused.Request.URL); err == nil && strings.EqualFold(target.Host, u.Host) {
+				params = params.WithHeaders(mergeHeaders(paused.Request.Headers, header))
+			}
+			executor := cdp.WithExecutor(ctx, chromedp.FromContext(ctx).Target)
+			_ = params.Do(executor)
+		}()
+	})
+	patterns := []*fetch.RequestPattern{{URLPattern: "*", ResourceType: network.ResourceTypeDocument}}
+	return chromedp.Run(ctx, fetch.Enable().WithPatterns(patterns))
+}
+
+// 浏览器原有的请求头加上额外的请求头，同名时使用额外的请求头
+func mergeHeaders(origin network.Headers, extra http.Header) []*fetch.HeaderEntry {
+	entries := make([]*fetch.HeaderEntry, 0, len(origin)+len(extra))
+	for k, v := range origin {
+		if _, ok := extra[http.CanonicalHeaderKey(k)]; ok {
+			continue
+		}
+		entries = append(entries, &fetch.HeaderEntry{Name: k, Value: fmt.Sprint(v)})
+	}
+	for k, v := range extra {
+		entries = append(entries, &fetch.HeaderEntry{Name: k, Value: strings.Join(v, ", ")})
+	}
+	return entries
+}
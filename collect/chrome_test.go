@@ -0,0 +1,138 @@
+package collect
+
+import (
+	"fmt"
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/network"
+	"github.com/stretchr/testify/assert"
+	"gocrawler/spider"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func findChrome(t *testing.T) string {
+	for _, name := range []string{"headless-shell", "chromium", "chromium-browser", "google-chrome"} {
+		if path, err := exec.LookPath(name); err == nil {
+			return path
+		}
+	}
+	t.Skip("chromium not found")
+	return ""
+}
+
+func TestChromeFetch(t *testing.T) {
+	browser := &Browser{ExecPath: findChrome(t)}
+	defer browser.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/page", http.StatusFound)
+	})
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<html><body><script>
+setTimeout(function() {
+	var d = document.createElement("div");
+	d.id = "content";
+	d.textContent = "rendered " + navigator.userAgent;
+	document.body.appendChild(d);
+}, 200);
+</script></body></html>`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	f := &ChromeFetch{
+		Browser:      browser,
+		Timeout:      30 * time.Second,
+		WaitSelector: "#content",
+		WaitIdle:     100 * time.Millisecond,
+		Screenshot:   true,
+	}
+	req := &spider.Request{URL: server.URL + "/old", Header: http.Header{"User-Agent": []string{"gocrawler-test"}}}
+	resp, err := f.Get(req)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, server.URL+"/page", resp.URL)
+	assert.Equal(t, []string{server.URL + "/old"}, resp.Redirects)
+	assert.Contains(t, string(resp.Body), "rendered gocrawler-test")
+	assert.NotEmpty(t, resp.Screenshot)
+
+	_, err = f.Get(&spider.Request{URL: server.URL + "/missing"})
+	assert.Equal(t, 404, spider.StatusCode(err))
+}
+
+func TestChromeFetch_Headers(t *testing.T) {
+	browser := &Browser{ExecPath: findChrome(t)}
+	defer browser.Close()
+
+	// 第三方资源不能收到任务的 Cookie 与请求头
+	var lock sync.Mutex
+	var thirdParty []string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		thirdParty = append(thirdParty, r.Header.Get("Cookie")+r.Header.Get("X-Token"))
+		lock.Unlock()
+	}))
+	defer other.Close()
+	otherURL := strings.Replace(other.URL, "127.0.0.1", "localhost", 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, _ := r.Cookie("sid")
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, `<html><body><div id="token">%s</div><div id="sid">%v</div><img src="%s/pixel.png"></body></html>`,
+			r.Header.Get("X-Token"), c != nil && c.Value == "1", otherURL)
+	}))
+	defer server.Close()
+
+	f := &ChromeFetch{Browser: browser, WaitIdle: 200 * time.Millisecond}
+	req := &spider.Request{URL: server.URL, Header: http.Header{"X-Token": []string{"abc"}}}
+	req.AddCookie("sid", "1")
+	resp, err := f.Get(req)
+	assert.Nil(t, err)
+	assert.Contains(t, string(resp.Body), `<div id="token">abc</div>`)
+	assert.Contains(t, string(resp.Body), `<div id="sid">true</div>`)
+	lock.Lock()
+	defer lock.Unlock()
+	assert.NotEmpty(t, thirdParty)
+	for _, h := range thirdParty {
+		assert.Empty(t, h)
+	}
+}
+
+func TestMergeHeaders(t *testing.T) {
+	entries := mergeHeaders(network.Headers{"accept": "text/html", "x-token": "old"}, http.Header{"X-Token": []string{"new"}})
+	got := make(map[string]string)
+	for _, e := range entries {
+		got[e.Name] = e.Value
+	}
+	assert.Equal(t, map[string]string{"accept": "text/html", "X-Token": "new"}, got)
+}
+
+func TestPageEvents(t *testing.T) {
+	e := newPageEvents()
+	doc := func(id network.RequestID, frame cdp.FrameID, redirect string) *network.EventRequestWillBeSent {
+		ev := &network.EventRequestWillBeSent{RequestID: id, FrameID: frame, Type: network.ResourceTypeDocument}
+		if redirect != "" {
+			ev.RedirectResponse = &network.Response{URL: redirect}
+		}
+		return ev
+	}
+	// 主文档重定向一次，iframe 重定向一次
+	e.handle(doc("1", "main", ""), "main")
+	e.handle(doc("1", "main", "http://a.com/old"), "main")
+	e.handle(doc("2", "child", ""), "main")
+	e.handle(doc("2", "child", "http://ad.com/old"), "main")
+	assert.Equal(t, []string{"http://a.com/old"}, e.redirectURLs())
+	assert.False(t, e.idle(0))
+
+	e.handle(&network.EventLoadingFinished{RequestID: "1"}, "main")
+	e.handle(&network.EventLoadingFailed{RequestID: "2"}, "main")
+	assert.True(t, e.idle(0))
+	assert.False(t, e.idle(time.Hour))
+}
@@ -2,9 +2,9 @@ package collect
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"go.uber.org/zap"
-	"gocrawler/extensions"
 	"gocrawler/proxy"
 	"gocrawler/spider"
 	"golang.org/x/net/html/charset"
@@ -12,8 +12,9 @@ import (
 	"golang.org/x/text/encoding/unicode"
 	"golang.org/x/text/transform"
 	"io"
-	"io/ioutil"
 	"net/http"
+	"net/url"
+	"sync"
 	"time"
 )
 
@@ -21,8 +22,14 @@ type BaseFetch struct {
 }
 
 // 实现 Fetcher 接口
-func (BaseFetch) Get(req *spider.Request) ([]byte, error) {
-	resp, err := http.Get(req.URL)
+func (BaseFetch) Get(request *spider.Request) (*spider.Response, error) {
+	req, err := request.HTTPRequest()
+	if err != nil {
+		return nil, fmt.Errorf("get url failed:%v", err)
+	}
+
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
 
 	if err != nil {
 		return nil, err
@@ -30,63 +37,153 @@ func (BaseFetch) Get(req *spider.Request) ([]byte, error) {
 
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("error status code:%d", resp.StatusCode)
-	}
-	bodyReader := bufio.NewReader(resp.Body)
-	e := DeterminEncoding(bodyReader)
-	utf8Reader := transform.NewReader(bodyReader, e.NewDecoder())
-	return ioutil.ReadAll(utf8Reader)
+	return readResponse(resp, start, 0)
 }
 
 type BrowserFetch struct {
-	Timeout time.Duration
-	Proxy   proxy.Func
-	Logger  *zap.Logger
+	Timeout     time.Duration // 整个请求的超时时间，包括读取响应体
+	Proxy       proxy.Func
+	Logger      *zap.Logger
+	Transport   TransportConfig
+	MaxBodySize int64 // 响应体的最大字节数，为 0 时不限制
+
+	once   sync.Once
+	client *http.Client
+	err    error
+}
+
+// 第一次抓取时创建 http.Client，之后所有请求复用同一个 Transport 的连接池
+func (b *BrowserFetch) init() error {
+	b.once.Do(func() {
+		var t *http.Transport
+		if t, b.err = NewTransport(b.Transport, b.Proxy); b.err != nil {
+			return
+		}
+		b.client = &http.Client{
+			Timeout:   b.Timeout,
+			Transport: t,
+		}
+	})
+	return b.err
 }
 
 // 模拟浏览器访问
-func (b BrowserFetch) Get(request *spider.Request) ([]byte, error) {
-	client := &http.Client{
-		Timeout: b.Timeout,
-	}
-	if b.Proxy != nil {
-		transport := http.DefaultTransport.(*http.Transport)
-		transport.Proxy = b.Proxy
-		client.Transport = transport
+func (b *BrowserFetch) Get(request *spider.Request) (*spider.Response, error) {
+	if err := b.init(); err != nil {
+		return nil, err
 	}
 
-	req, err := http.NewRequest("GET", request.URL, nil)
+	req, err := request.HTTPRequest()
 	if err != nil {
 		return nil, fmt.Errorf("get url failed:%v", err)
 	}
-	if len(request.Task.Cookie) > 0 {
-		req.Header.Set("Cookie", request.Task.Cookie)
+
+	// 代理池的中间件指定了代理，需要在 Transport 中生效
+	if request.Proxy != "" {
+		u, err := url.Parse(request.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy:%w", err)
+		}
+		req = req.WithContext(proxy.WithURL(req.Context(), u))
+	}
+
+	start := time.Now()
+	resp, err := b.client.Do(req)
+
+	if err != nil {
+		return nil, err
 	}
 
-	req.Header.Set("User-Agent", extensions.GenerateRandomUA())
+	defer resp.Body.Close()
 
-	resp, err := client.Do(req)
+	return readResponse(resp, start, b.MaxBodySize)
+}
 
+// 响应体超过 BrowserFetch.MaxBodySize
+var ErrBodyTooLarge = errors.New("response body too large")
+
+// 检查状态码，并将响应内容转换为 UTF-8，maxSize 为 0 时不限制响应体大小
+func readResponse(resp *http.Response, start time.Time, maxSize int64) (*spider.Response, error) {
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, spider.ErrNotModified
+	}
+	r := &spider.Response{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		URL:        resp.Request.URL.String(),
+		Redirects:  redirects(resp),
+	}
+	body, name, err := readBody(resp, maxSize)
+	r.Body, r.Charset = body, name
+	r.Elapsed = time.Since(start)
+	// 非 200 的响应同样带上响应头与内容，用于识别封禁页面与 Retry-After，内容读取失败时只保留响应头
+	if resp.StatusCode != http.StatusOK {
+		return nil, &spider.StatusError{Code: resp.StatusCode, Response: r}
+	}
 	if err != nil {
 		return nil, err
 	}
+	return r, nil
+}
 
-	bodyReader := bufio.NewReader(resp.Body)
-	e := DeterminEncoding(bodyReader)
+// 读取响应内容并转换为 UTF-8
+func readBody(resp *http.Response, maxSize int64) ([]byte, string, error) {
+	var r io.Reader = resp.Body
+	if maxSize > 0 {
+		if resp.ContentLength > maxSize {
+			return nil, "", fmt.Errorf("%w:%d", ErrBodyTooLarge, resp.ContentLength)
+		}
+		r = &limitedReader{R: resp.Body, N: maxSize}
+	}
+	bodyReader := bufio.NewReader(r)
+	e, name := determineCharset(bodyReader, resp.Header.Get("Content-Type"))
 	utf8Reader := transform.NewReader(bodyReader, e.NewDecoder())
-	return io.ReadAll(utf8Reader)
+	body, err := io.ReadAll(utf8Reader)
+	if err != nil {
+		return nil, "", err
+	}
+	return body, name, nil
+}
+
+// 读取的原始字节数超过 N 时返回 ErrBodyTooLarge
+type limitedReader struct {
+	R    io.Reader
+	N    int64
+	read int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.R.Read(p)
+	l.read += int64(n)
+	if l.read > l.N {
+		return n, fmt.Errorf("%w:more than %d bytes", ErrBodyTooLarge, l.N)
+	}
+	return n, err
+}
+
+// 根据重定向响应依次找到之前的请求地址
+func redirects(resp *http.Response) []string {
+	var urls []string
+	for r := resp.Request; r.Response != nil; {
+		r = r.Response.Request
+		urls = append([]string{r.URL.String()}, urls...)
+	}
+	return urls
 }
 
 // 检测并返回当前 HTML 文本的编码格式
 func DeterminEncoding(r *bufio.Reader) encoding.Encoding {
-	bytes, err := r.Peek(1024)
+	e, _ := determineCharset(r, "")
+	return e
+}
 
-	if err != nil {
-		fmt.Printf("fetch error:%v\n", err)
-		return unicode.UTF8
+func determineCharset(r *bufio.Reader, contentType string) (encoding.Encoding, string) {
+	// 内容不足 1024 字节时 Peek 返回 EOF，仍然使用已读取的内容检测
+	bytes, err := r.Peek(1024)
+	if err != nil && len(bytes) == 0 {
+		return unicode.UTF8, "utf-8"
 	}
 
-	e, _, _ := charset.DetermineEncoding(bytes, "")
-	return e
+	e, name, _ := charset.DetermineEncoding(bytes, contentType)
+	return e, name
 }
@@ -0,0 +1,83 @@
+package collect
+
+import (
+	"github.com/stretchr/testify/assert"
+	"gocrawler/spider"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBaseFetch_Response(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/new", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := simplifiedchinese.GBK.NewEncoder().String("<html><body>豆瓣读书</body></html>")
+		w.Header().Set("Content-Type", "text/html; charset=gbk")
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(body))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := BaseFetch{}.Get(&spider.Request{URL: server.URL + "/old"})
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, server.URL+"/new", resp.URL)
+	assert.Equal(t, []string{server.URL + "/old"}, resp.Redirects)
+	assert.Equal(t, "gbk", resp.Charset)
+	assert.Equal(t, "text/html", resp.ContentType())
+	assert.Equal(t, `"v1"`, resp.Validator().ETag)
+	assert.Contains(t, string(resp.Body), "豆瓣读书")
+
+	_, err = BaseFetch{}.Get(&spider.Request{URL: server.URL + "/missing"})
+	assert.Equal(t, 404, spider.StatusCode(err))
+	// 错误状态码的响应同样带上响应头与内容
+	eresp := spider.ErrorResponse(err)
+	assert.NotNil(t, eresp)
+	assert.Equal(t, 404, eresp.StatusCode)
+	assert.Equal(t, "text/plain", eresp.ContentType())
+	assert.Contains(t, string(eresp.Body), "404 page not found")
+}
+
+func TestBrowserFetch_Transport(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto + strings.Repeat(".", 100)))
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	defaultProxy := http.DefaultTransport.(*http.Transport).Proxy
+	f := &BrowserFetch{
+		Transport: TransportConfig{InsecureSkipVerify: true},
+		Proxy:     func(*http.Request) (*url.URL, error) { return nil, nil },
+	}
+	resp, err := f.Get(&spider.Request{URL: server.URL})
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(string(resp.Body), "HTTP/2.0"))
+	// 不修改全局的 DefaultTransport
+	assert.Equal(t, reflect.ValueOf(defaultProxy).Pointer(), reflect.ValueOf(http.DefaultTransport.(*http.Transport).Proxy).Pointer())
+
+	f = &BrowserFetch{Transport: TransportConfig{InsecureSkipVerify: true, DisableHTTP2: true}}
+	resp, err = f.Get(&spider.Request{URL: server.URL})
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(string(resp.Body), "HTTP/1.1"))
+
+	f = &BrowserFetch{Transport: TransportConfig{InsecureSkipVerify: true}, MaxBodySize: 50}
+	_, err = f.Get(&spider.Request{URL: server.URL})
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+
+	f = &BrowserFetch{}
+	_, err = f.Get(&spider.Request{URL: server.URL})
+	assert.NotNil(t, err, "untrusted certificate")
+
+	_, err = NewTransport(TransportConfig{TLSMinVersion: "2.0"}, nil)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,154 @@
+package collect
+
+import (
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"gocrawler/cache"
+	"gocrawler/extensions"
+	"gocrawler/spider"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+func init() {
+	spider.RegisterMiddleware("header", func(args map[string]string) (spider.Middleware, error) {
+		return Header(args), nil
+	})
+	spider.RegisterMiddleware("random_ua", func(args map[string]string) (spider.Middleware, error) {
+		return RandomUA(), nil
+	})
+	spider.RegisterMiddleware("basic_auth", func(args map[string]string) (spider.Middleware, error) {
+		if args["user"] == "" {
+			return nil, errors.New("user is required")
+		}
+		return BasicAuth(args["user"], args["password"]), nil
+	})
+	spider.RegisterMiddleware("bearer", func(args map[string]string) (spider.Middleware, error) {
+		if args["token"] == "" {
+			return nil, errors.New("token is required")
+		}
+		return Header(map[string]string{"Authorization": "Bearer " + args["token"]}), nil
+	})
+	spider.RegisterMiddleware("log", func(args map[string]string) (spider.Middleware, error) {
+		return Log(zap.L()), nil
+	})
+	// 参数：dir 缓存目录，默认 data/cache；mode 为 record、replay 或 passthrough，默认 passthrough；
+	// ttl passthrough 模式下的有效期，秒，默认永不过期
+	spider.RegisterMiddleware("cache", func(args map[string]string) (spider.Middleware, error) {
+		dir := args["dir"]
+		if dir == "" {
+			dir = "data/cache"
+		}
+		mode := cache.Mode(args["mode"])
+		if mode == "" {
+			mode = cache.Passthrough
+		}
+		var ttl time.Duration
+		if args["ttl"] != "" {
+			sec, err := strconv.Atoi(args["ttl"])
+			if err != nil {
+				return nil, fmt.Errorf("invalid ttl:%w", err)
+			}
+			ttl = time.Duration(sec) * time.Second
+		}
+		c, err := cache.New(dir, mode, ttl)
+		if err != nil {
+			return nil, err
+		}
+		c.Logger = zap.L()
+		return c.Middleware(), nil
+	})
+}
+
+// 修改请求后交给下一个 Fetcher
+// 传递的仍是原请求，内层记录的 Proxy、Session 等字段对引擎可见；
+// 请求头与 Cookie 在返回后恢复，中间件添加的内容不会随请求持久化或在重试时重复添加
+func before(fn func(req *spider.Request)) spider.Middleware {
+	return func(next spider.Fetcher) spider.Fetcher {
+		return spider.FetchFunc(func(req *spider.Request) (*spider.Response, error) {
+			header, cookies := req.Header, req.Cookies
+			defer func() {
+				req.Header, req.Cookies = header, cookies
+			}()
+			req.Header = header.Clone()
+			req.Cookies = slices.Clone(cookies)
+			fn(req)
+			return next.Get(req)
+		})
+	}
+}
+
+func setRequestHeader(req *spider.Request, key, value string) {
+	if req.Header == nil {
+		req.Header = make(http.Header)
+	}
+	req.Header.Set(key, value)
+}
+
+// 为每个请求添加固定的请求头
+func Header(headers map[string]string) spider.Middleware {
+	return before(func(req *spider.Request) {
+		for k, v := range headers {
+			setRequestHeader(req, k, v)
+		}
+	})
+}
+
+// 为每个请求设置随机的 User-Agent
+func RandomUA() spider.Middleware {
+	return before(func(req *spider.Request) {
+		setRequestHeader(req, "User-Agent", extensions.GenerateRandomUA())
+	})
+}
+
+// 没有设置 User-Agent 时使用随机的 User-Agent
+func DefaultUA() spider.Middleware {
+	return before(func(req *spider.Request) {
+		if req.Header.Get("User-Agent") == "" {
+			setRequestHeader(req, "User-Agent", extensions.GenerateRandomUA())
+		}
+	})
+}
+
+// 发送任务配置的 Cookie 字符串，请求自身的 Cookie 在后面
+// 会话池接管 Cookie 时任务的 Cookie 为空
+func TaskCookie() spider.Middleware {
+	return before(func(req *spider.Request) {
+		if req.Task == nil || req.Task.Cookie == "" {
+			return
+		}
+		r := http.Request{Header: http.Header{"Cookie": []string{req.Task.Cookie}}}
+		req.Cookies = append(r.Cookies(), req.Cookies...)
+	})
+}
+
+func BasicAuth(user, password string) spider.Middleware {
+	return before(func(req *spider.Request) {
+		r := http.Request{Header: make(http.Header)}
+		r.SetBasicAuth(user, password)
+		setRequestHeader(req, "Authorization", r.Header.Get("Authorization"))
+	})
+}
+
+// 记录每个请求的耗时与响应大小
+func Log(logger *zap.Logger) spider.Middleware {
+	return func(next spider.Fetcher) spider.Fetcher {
+		return spider.FetchFunc(func(req *spider.Request) (*spider.Response, error) {
+			start := time.Now()
+			resp, err := next.Get(req)
+			fields := []zap.Field{
+				zap.String("url", req.URL),
+				zap.Duration("elapsed", time.Since(start)),
+				zap.Error(err),
+			}
+			if resp != nil {
+				fields = append(fields, zap.Int("status", resp.StatusCode), zap.Int("size", len(resp.Body)))
+			}
+			logger.Debug("fetch", fields...)
+			return resp, err
+		})
+	}
+}
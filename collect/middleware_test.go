@@ -0,0 +1,36 @@
+package collect
+
+import (
+	"github.com/stretchr/testify/assert"
+	"gocrawler/spider"
+	"net/http"
+	"testing"
+)
+
+func TestDefaultMiddlewares(t *testing.T) {
+	var got *http.Request
+	f := spider.Chain(spider.FetchFunc(func(req *spider.Request) (*spider.Response, error) {
+		var err error
+		got, err = req.HTTPRequest()
+		req.Proxy = "http://proxy"
+		return &spider.Response{URL: req.URL}, err
+	}), DefaultUA(), TaskCookie())
+
+	task := &spider.Task{Options: spider.Options{Cookie: "sid=1"}}
+	req := &spider.Request{Task: task, URL: "http://a.com"}
+	req.AddCookie("token", "abc")
+	_, err := f.Get(req)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, got.Header.Get("User-Agent"))
+	assert.Equal(t, "sid=1; token=abc", got.Header.Get("Cookie"))
+	// 中间件添加的请求头与 Cookie 在返回后恢复，内层记录的字段保留在原请求上
+	assert.Nil(t, req.Header)
+	assert.Len(t, req.Cookies, 1)
+	assert.Equal(t, "http://proxy", req.Proxy)
+
+	req = &spider.Request{Task: &spider.Task{}, URL: "http://a.com", Header: http.Header{"User-Agent": []string{"test"}}}
+	_, err = f.Get(req)
+	assert.Nil(t, err)
+	assert.Equal(t, "test", got.Header.Get("User-Agent"))
+	assert.Equal(t, "", got.Header.Get("Cookie"))
+}
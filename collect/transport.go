@@ -0,0 +1,99 @@
+package collect
+
+import (
+	"crypto/tls"
+	"fmt"
+	"gocrawler/proxy"
+	"net"
+	"net/http"
+	"time"
+)
+
+// 连接池、超时与 TLS 设置，零值字段使用 DefaultTransportConfig 中的值
+type TransportConfig struct {
+	MaxIdleConns          int           // 所有域名的空闲连接数
+	MaxIdleConnsPerHost   int           // 每个域名的空闲连接数
+	MaxConnsPerHost       int           // 每个域名的最大连接数，为 0 时不限制
+	IdleConnTimeout       time.Duration // 空闲连接的保持时间
+	DialTimeout           time.Duration // 建立 TCP 连接的超时时间
+	KeepAlive             time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration // 发出请求后等待响应头的时间，为 0 时不限制
+	DisableHTTP2          bool
+	InsecureSkipVerify    bool   // 不校验服务端证书
+	TLSMinVersion         string // 1.0、1.1、1.2、1.3，为空时使用 Go 的默认值
+}
+
+var DefaultTransportConfig = TransportConfig{
+	MaxIdleConns:        100,
+	MaxIdleConnsPerHost: 10,
+	IdleConnTimeout:     90 * time.Second,
+	DialTimeout:         30 * time.Second,
+	KeepAlive:           30 * time.Second,
+	TLSHandshakeTimeout: 10 * time.Second,
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// 创建独立的 Transport，不会修改 http.DefaultTransport
+func NewTransport(cfg TransportConfig, p proxy.Func) (*http.Transport, error) {
+	def := DefaultTransportConfig
+	if cfg.MaxIdleConns == 0 {
+		cfg.MaxIdleConns = def.MaxIdleConns
+	}
+	if cfg.MaxIdleConnsPerHost == 0 {
+		cfg.MaxIdleConnsPerHost = def.MaxIdleConnsPerHost
+	}
+	if cfg.IdleConnTimeout == 0 {
+		cfg.IdleConnTimeout = def.IdleConnTimeout
+	}
+	if cfg.DialTimeout == 0 {
+		cfg.DialTimeout = def.DialTimeout
+	}
+	if cfg.KeepAlive == 0 {
+		cfg.KeepAlive = def.KeepAlive
+	}
+	if cfg.TLSHandshakeTimeout == 0 {
+		cfg.TLSHandshakeTimeout = def.TLSHandshakeTimeout
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify}
+	if cfg.TLSMinVersion != "" {
+		v, ok := tlsVersions[cfg.TLSMinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown tls version:%s", cfg.TLSMinVersion)
+		}
+		tlsConfig.MinVersion = v
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   cfg.DialTimeout,
+		KeepAlive: cfg.KeepAlive,
+	}
+	t := &http.Transport{
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       tlsConfig,
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.MaxConnsPerHost,
+		IdleConnTimeout:       cfg.IdleConnTimeout,
+		TLSHandshakeTimeout:   cfg.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: cfg.ResponseHeaderTimeout,
+		ExpectContinueTimeout: time.Second,
+		ForceAttemptHTTP2:     !cfg.DisableHTTP2,
+		Proxy:                 http.ProxyFromEnvironment,
+	}
+	if p != nil {
+		t.Proxy = p
+	}
+	if cfg.DisableHTTP2 {
+		// TLSNextProto 不为 nil 时不会协商 HTTP/2
+		t.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+	return t, nil
+}
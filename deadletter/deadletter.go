@@ -0,0 +1,148 @@
+package deadletter
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gocrawler/spider"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	entryFile   = "deadletter.jsonl"
+	redriveFile = "redrive.jsonl"
+)
+
+// 失败队列中的一条记录
+type Entry struct {
+	Request    spider.RequestRecord `json:"request"`
+	Error      string               `json:"error"`
+	StatusCode int                  `json:"status_code,omitempty"`
+	Attempts   int                  `json:"attempts"`
+	Time       time.Time            `json:"time"`
+}
+
+// Queue 保存在本地目录中的失败队列
+// deadletter.jsonl 记录超过重试次数的请求，redrive.jsonl 记录等待重新执行的请求
+// 每次写入都重新以追加模式打开文件，CLI 与 worker 进程可以同时操作同一目录
+type Queue struct {
+	dir  string
+	lock sync.Mutex
+}
+
+func New(dir string) (*Queue, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Queue{dir: dir}, nil
+}
+
+func (q *Queue) Add(entries ...Entry) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return appendEntries(filepath.Join(q.dir, entryFile), entries)
+}
+
+// 返回失败队列中的全部记录
+func (q *Queue) List() ([]Entry, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return readEntries(filepath.Join(q.dir, entryFile))
+}
+
+// 将满足 match 的记录移动到重放队列中，worker 启动时以及运行期间会定时取出并重新执行这些请求
+func (q *Queue) Redrive(match func(Entry) bool) (int, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	entries, err := q.take(entryFile)
+	if err != nil {
+		return 0, err
+	}
+	var keep, redrive []Entry
+	for _, e := range entries {
+		if match == nil || match(e) {
+			redrive = append(redrive, e)
+		} else {
+			keep = append(keep, e)
+		}
+	}
+	if err := appendEntries(filepath.Join(q.dir, redriveFile), redrive); err != nil {
+		return 0, err
+	}
+	if err := appendEntries(filepath.Join(q.dir, entryFile), keep); err != nil {
+		return 0, err
+	}
+	return len(redrive), nil
+}
+
+// 取出并清空重放队列
+func (q *Queue) TakeRedrive() ([]Entry, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.take(redriveFile)
+}
+
+// 将文件重命名后读取，之后的写入会落到新文件上，避免读取期间丢失其他进程追加的记录
+func (q *Queue) take(name string) ([]Entry, error) {
+	path := filepath.Join(q.dir, name)
+	tmp := fmt.Sprintf("%s.%d.tmp", path, time.Now().UnixNano())
+	if err := os.Rename(path, tmp); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	entries, err := readEntries(tmp)
+	if err != nil {
+		return nil, err
+	}
+	return entries, os.Remove(tmp)
+}
+
+func appendEntries(path string, entries []Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+func readEntries(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []Entry
+	dec := json.NewDecoder(f)
+	for dec.More() {
+		var e Entry
+		if err := dec.Decode(&e); err != nil {
+			return entries, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
@@ -0,0 +1,35 @@
+package deadletter
+
+import (
+	"github.com/stretchr/testify/assert"
+	"gocrawler/spider"
+	"testing"
+)
+
+func TestQueue_Redrive(t *testing.T) {
+	q, err := New(t.TempDir())
+	assert.Nil(t, err)
+
+	assert.Nil(t, q.Add(
+		Entry{Request: spider.RequestRecord{TaskName: "a", URL: "http://a.com"}, Attempts: 2},
+		Entry{Request: spider.RequestRecord{TaskName: "b", URL: "http://b.com"}, Attempts: 2},
+	))
+
+	n, err := q.Redrive(func(e Entry) bool { return e.Request.TaskName == "a" })
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	entries, err := q.List()
+	assert.Nil(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "b", entries[0].Request.TaskName)
+
+	redrive, err := q.TakeRedrive()
+	assert.Nil(t, err)
+	assert.Len(t, redrive, 1)
+	assert.Equal(t, "http://a.com", redrive[0].Request.URL)
+
+	redrive, err = q.TakeRedrive()
+	assert.Nil(t, err)
+	assert.Empty(t, redrive)
+}
@@ -0,0 +1,90 @@
+package dedup
+
+import (
+	"errors"
+	"hash/fnv"
+	"math"
+	"sync"
+)
+
+// Bloom 基于布隆过滤器的去重器，适用于千万级 URL 的抓取
+// 布隆过滤器存在一定误判率，可能将未访问的请求判定为已访问，但不会漏判
+// 由于布隆过滤器无法删除元素，Delete 的请求会记录在一个较小的内存集合中
+type Bloom struct {
+	bits    []uint64
+	m       uint64 // 位数组长度
+	k       uint64 // 哈希函数个数
+	deleted map[string]struct{}
+	lock    sync.RWMutex
+}
+
+// NewBloom 根据预期元素数量 n 与误判率 fp 计算位数组长度与哈希函数个数
+func NewBloom(n uint64, fp float64) (*Bloom, error) {
+	if n == 0 {
+		return nil, errors.New("bloom capacity must be positive")
+	}
+	if fp <= 0 || fp >= 1 {
+		return nil, errors.New("bloom false positive rate must be in (0, 1)")
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(fp) / (math.Ln2 * math.Ln2)))
+	k := uint64(math.Max(1, math.Round(float64(m)/float64(n)*math.Ln2)))
+
+	return &Bloom{
+		bits:    make([]uint64, (m+63)/64),
+		m:       m,
+		k:       k,
+		deleted: make(map[string]struct{}),
+	}, nil
+}
+
+// 使用双重哈希 h1 + i*h2 模拟 k 个哈希函数
+func (b *Bloom) locations(key string) []uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	h1 := h.Sum64()
+	h2 := h1>>33 | h1<<31
+	h2 |= 1
+
+	locs := make([]uint64, b.k)
+	for i := uint64(0); i < b.k; i++ {
+		locs[i] = (h1 + i*h2) % b.m
+	}
+	return locs
+}
+
+func (b *Bloom) Visited(key string) bool {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	if _, ok := b.deleted[key]; ok {
+		return false
+	}
+	for _, loc := range b.locations(key) {
+		if b.bits[loc/64]&(1<<(loc%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *Bloom) Store(keys ...string) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for _, key := range keys {
+		delete(b.deleted, key)
+		for _, loc := range b.locations(key) {
+			b.bits[loc/64] |= 1 << (loc % 64)
+		}
+	}
+	return nil
+}
+
+func (b *Bloom) Delete(key string) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.deleted[key] = struct{}{}
+	return nil
+}
+
+func (b *Bloom) Close() error {
+	return nil
+}
@@ -0,0 +1,9 @@
+package dedup
+
+// Deduper 记录请求是否已被访问，Key 为 Request.Unique() 生成的唯一标识
+type Deduper interface {
+	Visited(key string) bool    // 判断请求是否已访问
+	Store(keys ...string) error // 标记请求已访问
+	Delete(key string) error    // 取消访问标记，用于失败重试
+	Close() error               // 释放底层资源
+}
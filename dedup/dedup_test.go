@@ -0,0 +1,49 @@
+package dedup
+
+import (
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestFileReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "visited.log")
+	d, err := NewFile(path)
+	assert.Nil(t, err)
+	assert.Nil(t, d.Store("a", "b"))
+	assert.Nil(t, d.Delete("a"))
+	assert.Nil(t, d.Close())
+
+	d, err = NewFile(path)
+	assert.Nil(t, err)
+	defer d.Close()
+	assert.False(t, d.Visited("a"))
+	assert.True(t, d.Visited("b"))
+}
+
+func TestBloomFalsePositive(t *testing.T) {
+	n := 10000
+	b, err := NewBloom(uint64(n), 0.01)
+	assert.Nil(t, err)
+
+	for i := 0; i < n; i++ {
+		assert.Nil(t, b.Store(strconv.Itoa(i)))
+	}
+	for i := 0; i < n; i++ {
+		assert.True(t, b.Visited(strconv.Itoa(i)))
+	}
+
+	falsePositive := 0
+	for i := n; i < 2*n; i++ {
+		if b.Visited(strconv.Itoa(i)) {
+			falsePositive++
+		}
+	}
+	assert.Less(t, float64(falsePositive)/float64(n), 0.02)
+
+	assert.Nil(t, b.Delete("1"))
+	assert.False(t, b.Visited("1"))
+	assert.Nil(t, b.Store("1"))
+	assert.True(t, b.Visited("1"))
+}
@@ -0,0 +1,107 @@
+package dedup
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	opStore  = '+'
+	opDelete = '-'
+)
+
+// File 基于本地追加日志的去重器
+// 每次变更以一行 "+key" 或 "-key" 追加写入文件，启动时回放日志恢复访问记录
+type File struct {
+	mem  *Memory
+	f    *os.File
+	w    *bufio.Writer
+	lock sync.Mutex
+}
+
+func NewFile(path string) (*File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	d := &File{
+		mem: NewMemory(),
+		f:   f,
+		w:   bufio.NewWriter(f),
+	}
+	if err := d.load(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("load visited log failed:%w", err)
+	}
+	return d, nil
+}
+
+// 回放日志
+func (d *File) load() error {
+	scanner := bufio.NewScanner(d.f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(line) < 2 {
+			continue
+		}
+		switch line[0] {
+		case opStore:
+			d.mem.visited[line[1:]] = struct{}{}
+		case opDelete:
+			delete(d.mem.visited, line[1:])
+		}
+	}
+	return scanner.Err()
+}
+
+func (d *File) Visited(key string) bool {
+	return d.mem.Visited(key)
+}
+
+func (d *File) Store(keys ...string) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	for _, k := range keys {
+		if err := d.append(opStore, k); err != nil {
+			return err
+		}
+	}
+	return d.mem.Store(keys...)
+}
+
+func (d *File) Delete(key string) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if err := d.append(opDelete, key); err != nil {
+		return err
+	}
+	return d.mem.Delete(key)
+}
+
+func (d *File) append(op byte, key string) error {
+	if err := d.w.WriteByte(op); err != nil {
+		return err
+	}
+	if _, err := d.w.WriteString(key); err != nil {
+		return err
+	}
+	if err := d.w.WriteByte('\n'); err != nil {
+		return err
+	}
+	return d.w.Flush()
+}
+
+func (d *File) Close() error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if err := d.w.Flush(); err != nil {
+		return err
+	}
+	return d.f.Close()
+}
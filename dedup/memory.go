@@ -0,0 +1,42 @@
+package dedup
+
+import "sync"
+
+// Memory 基于内存哈希表的去重器，进程重启后数据丢失
+type Memory struct {
+	visited map[string]struct{}
+	lock    sync.RWMutex
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		visited: make(map[string]struct{}, 100),
+	}
+}
+
+func (m *Memory) Visited(key string) bool {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	_, ok := m.visited[key]
+	return ok
+}
+
+func (m *Memory) Store(keys ...string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, k := range keys {
+		m.visited[k] = struct{}{}
+	}
+	return nil
+}
+
+func (m *Memory) Delete(key string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.visited, key)
+	return nil
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
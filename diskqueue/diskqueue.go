@@ -0,0 +1,279 @@
+package diskqueue
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	metaFile           = "meta.json"
+	defaultSegmentSize = 64 << 20
+)
+
+// Queue 基于本地文件的先进先出队列，每条消息占据一行
+// 消息按顺序追加写入分段文件，读取位置记录在 meta.json 中，进程重启后从上次的位置继续读取。
+// 读取位置在每次 Pop 后提交，进程崩溃时最多重复读取一批消息
+type Queue struct {
+	dir         string
+	segmentSize int64
+
+	writeSeg  int
+	writeFile *os.File
+	writeSize int64
+
+	meta  meta
+	count int
+	lock  sync.Mutex
+}
+
+type meta struct {
+	ReadSegment int   `json:"read_segment"`
+	ReadOffset  int64 `json:"read_offset"`
+}
+
+func Open(dir string) (*Queue, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	q := &Queue{
+		dir:         dir,
+		segmentSize: defaultSegmentSize,
+		meta:        meta{ReadSegment: 1},
+	}
+	if err := q.loadMeta(); err != nil {
+		return nil, err
+	}
+
+	segs, err := q.segments()
+	if err != nil {
+		return nil, err
+	}
+	q.writeSeg = q.meta.ReadSegment
+	if len(segs) > 0 && segs[len(segs)-1] > q.writeSeg {
+		q.writeSeg = segs[len(segs)-1]
+	}
+	if err := q.openWriter(); err != nil {
+		return nil, err
+	}
+
+	// 统计尚未读取的消息数量
+	for _, seg := range segs {
+		if seg < q.meta.ReadSegment {
+			continue
+		}
+		var offset int64
+		if seg == q.meta.ReadSegment {
+			offset = q.meta.ReadOffset
+		}
+		n, err := q.countLines(seg, offset)
+		if err != nil {
+			return nil, err
+		}
+		q.count += n
+	}
+	return q, nil
+}
+
+// 队列中尚未读取的消息数量
+func (q *Queue) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.count
+}
+
+func (q *Queue) Push(msgs ...[]byte) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	var buf bytes.Buffer
+	for _, msg := range msgs {
+		if bytes.IndexByte(msg, '\n') >= 0 {
+			return errors.New("message can not contain newline")
+		}
+		buf.Write(msg)
+		buf.WriteByte('\n')
+	}
+	if q.writeSize >= q.segmentSize {
+		if err := q.writeFile.Close(); err != nil {
+			return err
+		}
+		q.writeSeg++
+		if err := q.openWriter(); err != nil {
+			return err
+		}
+	}
+	n, err := q.writeFile.Write(buf.Bytes())
+	q.writeSize += int64(n)
+	if err != nil {
+		return err
+	}
+	q.count += len(msgs)
+	return nil
+}
+
+// 按写入顺序取出最多 n 条消息
+func (q *Queue) Pop(n int) ([][]byte, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	var msgs [][]byte
+	for len(msgs) < n && q.count > 0 {
+		f, err := os.Open(q.segmentPath(q.meta.ReadSegment))
+		if err != nil {
+			return msgs, err
+		}
+		if _, err := f.Seek(q.meta.ReadOffset, io.SeekStart); err != nil {
+			f.Close()
+			return msgs, err
+		}
+		r := bufio.NewReader(f)
+		for len(msgs) < n {
+			line, err := r.ReadBytes('\n')
+			if err != nil {
+				// 不完整的行留到下次读取
+				break
+			}
+			q.meta.ReadOffset += int64(len(line))
+			q.count--
+			msgs = append(msgs, line[:len(line)-1])
+		}
+		f.Close()
+
+		if len(msgs) < n && q.meta.ReadSegment < q.writeSeg {
+			// 当前分段已读完，删除后继续读取下一个分段
+			if err := os.Remove(q.segmentPath(q.meta.ReadSegment)); err != nil {
+				return msgs, err
+			}
+			q.meta.ReadSegment++
+			q.meta.ReadOffset = 0
+			continue
+		}
+		break
+	}
+	return msgs, q.saveMeta()
+}
+
+// 按写入顺序遍历尚未读取的消息，不会取出消息
+func (q *Queue) Scan(fn func(msg []byte) error) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for seg := q.meta.ReadSegment; seg <= q.writeSeg; seg++ {
+		var offset int64
+		if seg == q.meta.ReadSegment {
+			offset = q.meta.ReadOffset
+		}
+		if err := q.scanSegment(seg, offset, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (q *Queue) scanSegment(seg int, offset int64, fn func(msg []byte) error) error {
+	f, err := os.Open(q.segmentPath(seg))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			return nil
+		}
+		if err := fn(line[:len(line)-1]); err != nil {
+			return err
+		}
+	}
+}
+
+func (q *Queue) Close() error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if err := q.saveMeta(); err != nil {
+		return err
+	}
+	return q.writeFile.Close()
+}
+
+func (q *Queue) openWriter() error {
+	f, err := os.OpenFile(q.segmentPath(q.writeSeg), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	q.writeFile = f
+	q.writeSize = info.Size()
+	return nil
+}
+
+func (q *Queue) segmentPath(seg int) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%08d.seg", seg))
+}
+
+func (q *Queue) segments() ([]int, error) {
+	matches, err := filepath.Glob(filepath.Join(q.dir, "*.seg"))
+	if err != nil {
+		return nil, err
+	}
+	segs := make([]int, 0, len(matches))
+	for _, m := range matches {
+		var seg int
+		if _, err := fmt.Sscanf(filepath.Base(m), "%08d.seg", &seg); err == nil {
+			segs = append(segs, seg)
+		}
+	}
+	return segs, nil
+}
+
+func (q *Queue) countLines(seg int, offset int64) (int, error) {
+	n := 0
+	err := q.scanSegment(seg, offset, func([]byte) error {
+		n++
+		return nil
+	})
+	return n, err
+}
+
+func (q *Queue) loadMeta() error {
+	b, err := os.ReadFile(filepath.Join(q.dir, metaFile))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	return json.Unmarshal(b, &q.meta)
+}
+
+// 先写入临时文件再重命名，保证 meta.json 不会只写入一半
+func (q *Queue) saveMeta() error {
+	b, err := json.Marshal(q.meta)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(q.dir, metaFile)
+	if err := os.WriteFile(path+".tmp", b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
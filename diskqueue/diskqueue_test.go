@@ -0,0 +1,42 @@
+package diskqueue
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+)
+
+func TestQueue(t *testing.T) {
+	dir := t.TempDir()
+	q, err := Open(dir)
+	assert.Nil(t, err)
+	q.segmentSize = 16
+
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, q.Push([]byte("msg"+strconv.Itoa(i))))
+	}
+	assert.Equal(t, 10, q.Len())
+
+	msgs, err := q.Pop(4)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("msg0"), []byte("msg1"), []byte("msg2"), []byte("msg3")}, msgs)
+	assert.Nil(t, q.Close())
+
+	// 重新打开后从上次读取的位置继续
+	q, err = Open(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, 6, q.Len())
+	assert.Nil(t, q.Push([]byte("msg10")))
+
+	msgs, err = q.Pop(100)
+	assert.Nil(t, err)
+	assert.Len(t, msgs, 7)
+	assert.Equal(t, "msg4", string(msgs[0]))
+	assert.Equal(t, "msg10", string(msgs[6]))
+	assert.Equal(t, 0, q.Len())
+
+	segs, err := q.segments()
+	assert.Nil(t, err)
+	assert.Len(t, segs, 1)
+	assert.Nil(t, q.Close())
+}
@@ -0,0 +1,53 @@
+package engine
+
+import (
+	"gocrawler/spider"
+	"sync"
+	"time"
+)
+
+// 延迟一段时间后再放入调度器的请求，例如等待重试的请求
+type delayQueue struct {
+	timers  map[*spider.Request]*time.Timer
+	stopped bool
+	lock    sync.Mutex
+}
+
+func newDelayQueue() *delayQueue {
+	return &delayQueue{
+		timers: make(map[*spider.Request]*time.Timer),
+	}
+}
+
+// 等待 delay 后调用 push 将请求放回调度器
+func (q *delayQueue) Add(req *spider.Request, delay time.Duration, push func(...*spider.Request)) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.stopped {
+		push(req)
+		return
+	}
+	q.timers[req] = time.AfterFunc(delay, func() {
+		q.lock.Lock()
+		defer q.lock.Unlock()
+		if q.stopped {
+			return
+		}
+		delete(q.timers, req)
+		push(req)
+	})
+}
+
+// 停止所有定时器，返回尚未放回调度器的请求
+func (q *delayQueue) Stop() []*spider.Request {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.stopped = true
+	reqs := make([]*spider.Request, 0, len(q.timers))
+	for req, t := range q.timers {
+		t.Stop()
+		reqs = append(reqs, req)
+	}
+	q.timers = make(map[*spider.Request]*time.Timer)
+	return reqs
+}
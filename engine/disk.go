@@ -0,0 +1,144 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"go.uber.org/zap"
+	"gocrawler/diskqueue"
+	"gocrawler/spider"
+)
+
+// DiskSchedule 内存占用有上限的优先级调度器
+// 内存中的请求数量达到 watermark 后，新的请求会写入本地磁盘队列，
+// 内存中的请求不超过 watermark 的一半时再从磁盘中加载。
+// 调度器停止时内存中的请求会全部写入磁盘，下次启动时重新加载
+type DiskSchedule struct {
+	PrioritySchedule
+	disk      *diskqueue.Queue
+	watermark int
+	tasks     map[string]*spider.Task
+	Logger    *zap.Logger
+}
+
+// seeds 用于将磁盘中的请求还原到对应的任务上
+func NewDiskSchedule(dir string, watermark int, seeds []*spider.Task) (*DiskSchedule, error) {
+	disk, err := diskqueue.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	if watermark <= 0 {
+		watermark = 10000
+	}
+	s := &DiskSchedule{
+		PrioritySchedule: *NewPrioritySchedule(),
+		disk:             disk,
+		watermark:        watermark,
+		tasks:            make(map[string]*spider.Task, len(seeds)),
+		Logger:           zap.NewNop(),
+	}
+	for _, task := range seeds {
+		s.tasks[task.Name] = task
+	}
+	return s, nil
+}
+
+func (s *DiskSchedule) Schedule(ctx context.Context) {
+	defer func() {
+		reqs := s.drain()
+		if err := s.spill(reqs...); err != nil {
+			s.Logger.Error("save frontier to disk failed", zap.Error(err))
+			s.stop(reqs...)
+		}
+		if err := s.disk.Close(); err != nil {
+			s.Logger.Error("close disk queue failed", zap.Error(err))
+		}
+		close(s.done)
+	}()
+
+	s.refill()
+	for {
+		var req *spider.Request
+		var ch chan *spider.Request
+		q := s.peek()
+		if q != nil {
+			req = q.items[0].req
+			ch = s.workerCh
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case r := <-s.requestCh:
+			if s.count < s.watermark {
+				s.add(r)
+				continue
+			}
+			if err := s.spill(r); err != nil {
+				s.Logger.Error("spill request to disk failed", zap.Error(err))
+				s.add(r)
+			}
+		case ch <- req:
+			s.pop(q)
+			if s.count <= s.watermark/2 && s.disk.Len() > 0 {
+				s.refill()
+			}
+		}
+	}
+}
+
+// 将请求写入磁盘队列
+func (s *DiskSchedule) spill(reqs ...*spider.Request) error {
+	if len(reqs) == 0 {
+		return nil
+	}
+	msgs := make([][]byte, 0, len(reqs))
+	for _, req := range reqs {
+		b, err := json.Marshal(req.Record())
+		if err != nil {
+			return err
+		}
+		msgs = append(msgs, b)
+	}
+	return s.disk.Push(msgs...)
+}
+
+// 统计磁盘中上次遗留的请求数量，需要在 Schedule 之前调用
+func (s *DiskSchedule) Restored() map[string]int {
+	restored := make(map[string]int)
+	err := s.disk.Scan(func(msg []byte) error {
+		var rec spider.RequestRecord
+		if err := json.Unmarshal(msg, &rec); err != nil {
+			return nil
+		}
+		restored[rec.TaskName]++
+		return nil
+	})
+	if err != nil {
+		s.Logger.Error("scan disk queue failed", zap.Error(err))
+	}
+	return restored
+}
+
+// 从磁盘中加载请求，直到内存中的请求数量达到 watermark
+func (s *DiskSchedule) refill() {
+	msgs, err := s.disk.Pop(s.watermark - s.count)
+	if err != nil {
+		s.Logger.Error("load frontier from disk failed", zap.Error(err))
+	}
+	for _, msg := range msgs {
+		var rec spider.RequestRecord
+		if err := json.Unmarshal(msg, &rec); err != nil {
+			s.Logger.Error("decode frontier request failed", zap.Error(err))
+			continue
+		}
+		task, ok := s.tasks[rec.TaskName]
+		if !ok {
+			s.Logger.Error("can not find task of frontier request",
+				zap.String("task name", rec.TaskName),
+				zap.String("url", rec.URL),
+			)
+			continue
+		}
+		s.add(rec.Request(task))
+	}
+}
@@ -0,0 +1,80 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"gocrawler/spider"
+	"testing"
+	"time"
+)
+
+func TestDiskSchedule(t *testing.T) {
+	dir := t.TempDir()
+	task := &spider.Task{Options: spider.Options{Name: "disk", Weight: 1}}
+
+	s, err := NewDiskSchedule(dir, 4, []*spider.Task{task})
+	assert.Nil(t, err)
+	assert.Empty(t, s.Restored())
+	ctx, cancel := context.WithCancel(context.Background())
+	go s.Schedule(ctx)
+
+	for i := 0; i < 10; i++ {
+		s.Push(&spider.Request{Task: task, URL: fmt.Sprintf("http://a/%d", i)})
+	}
+
+	pulled := map[string]bool{}
+	for i := 0; i < 5; i++ {
+		pulled[s.Pull().URL] = true
+	}
+	cancel()
+	<-s.done
+	assert.Empty(t, s.Pending())
+
+	// 重新启动后恢复剩余的请求
+	s, err = NewDiskSchedule(dir, 4, []*spider.Task{task})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int{"disk": 5}, s.Restored())
+	ctx, cancel = context.WithCancel(context.Background())
+	go s.Schedule(ctx)
+	for i := 0; i < 5; i++ {
+		req := s.Pull()
+		assert.Equal(t, task, req.Task)
+		assert.False(t, pulled[req.URL])
+		pulled[req.URL] = true
+	}
+	assert.Len(t, pulled, 10)
+	cancel()
+	<-s.done
+}
+
+func TestDiskSchedule_MinWatermark(t *testing.T) {
+	task := &spider.Task{Options: spider.Options{Name: "disk", Weight: 1}}
+	s, err := NewDiskSchedule(t.TempDir(), 1, []*spider.Task{task})
+	assert.Nil(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	go s.Schedule(ctx)
+
+	for i := 0; i < 3; i++ {
+		s.Push(&spider.Request{Task: task, URL: fmt.Sprintf("http://a/%d", i)})
+	}
+	// watermark 为 1 时写入磁盘的请求也要能被重新加载
+	pulled := make(chan string)
+	go func() {
+		for i := 0; i < 3; i++ {
+			pulled <- s.Pull().URL
+		}
+	}()
+	urls := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		select {
+		case u := <-pulled:
+			urls[u] = true
+		case <-time.After(5 * time.Second):
+			t.Fatal("spilled requests not refilled")
+		}
+	}
+	assert.Len(t, urls, 3)
+	cancel()
+	<-s.done
+}
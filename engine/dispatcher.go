@@ -0,0 +1,60 @@
+package engine
+
+import (
+	"gocrawler/spider"
+	"sync"
+)
+
+// 调度器与 worker 之间传递请求的通道
+// 调度器停止后，新放入的请求与尚未分发的请求都会暂存在 pending 中
+type dispatcher struct {
+	requestCh   chan *spider.Request // 接收请求
+	workerCh    chan *spider.Request // 分配任务给worker
+	done        chan struct{}        // 调度器停止后关闭
+	pending     []*spider.Request    // 调度器停止后未分发的请求
+	pendingLock sync.Mutex
+}
+
+func newDispatcher() dispatcher {
+	return dispatcher{
+		requestCh: make(chan *spider.Request),
+		workerCh:  make(chan *spider.Request),
+		done:      make(chan struct{}),
+	}
+}
+
+// 将请求放入到调度器中
+func (d *dispatcher) Push(reqs ...*spider.Request) {
+	for _, req := range reqs {
+		select {
+		case d.requestCh <- req:
+		case <-d.done:
+			d.stop(req)
+		}
+	}
+}
+
+// 从调度器中获取请求
+func (d *dispatcher) Pull() *spider.Request {
+	select {
+	case r := <-d.workerCh:
+		return r
+	case <-d.done:
+		return nil
+	}
+}
+
+func (d *dispatcher) Pending() []*spider.Request {
+	d.pendingLock.Lock()
+	defer d.pendingLock.Unlock()
+	pending := d.pending
+	d.pending = nil
+	return pending
+}
+
+// 暂存调度器停止时尚未分发的请求
+func (d *dispatcher) stop(reqs ...*spider.Request) {
+	d.pendingLock.Lock()
+	defer d.pendingLock.Unlock()
+	d.pending = append(d.pending, reqs...)
+}
@@ -0,0 +1,558 @@
+package engine
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"gocrawler/deadletter"
+	"gocrawler/spider"
+	"golang.org/x/time/rate"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type fakeFetcher struct {
+	lock    sync.Mutex
+	fetched []string
+}
+
+func (f *fakeFetcher) Get(req *spider.Request) (*spider.Response, error) {
+	f.lock.Lock()
+	f.fetched = append(f.fetched, req.URL)
+	f.lock.Unlock()
+	return &spider.Response{StatusCode: 200, URL: req.URL, Body: []byte(strings.Repeat("a", 6000))}, nil
+}
+
+type fakeStorage struct {
+	saved   []*spider.DataCell
+	flushed bool
+}
+
+func (s *fakeStorage) Save(datas ...*spider.DataCell) error {
+	s.saved = append(s.saved, datas...)
+	return nil
+}
+
+func (s *fakeStorage) Flush() error {
+	s.flushed = true
+	return nil
+}
+
+func TestCrawler_RunShutdown(t *testing.T) {
+	const childCount = 20
+	saved := make(chan struct{}, 1)
+	Store.Add(&spider.Task{
+		Options: spider.Options{Name: "test_shutdown"},
+		Rule: spider.RuleTree{
+			Root: func() ([]*spider.Request, error) {
+				return []*spider.Request{{URL: "http://root", Method: "GET", RuleName: "root"}}, nil
+			},
+			Trunk: map[string]*spider.Rule{
+				"root": {ItemFields: []string{"title"}, ParseFunc: func(ctx *spider.Context) (spider.ParseResult, error) {
+					cell, err := ctx.Output(map[string]interface{}{"title": "root"})
+					if err != nil {
+						return spider.ParseResult{}, err
+					}
+					result := spider.ParseResult{Items: []interface{}{cell}}
+					for i := 0; i < childCount; i++ {
+						result.Requesrts = append(result.Requesrts, &spider.Request{
+							Task:     ctx.Req.Task,
+							URL:      fmt.Sprintf("http://child/%d", i),
+							Method:   "GET",
+							Depth:    ctx.Req.Depth + 1,
+							RuleName: "child",
+						})
+					}
+					saved <- struct{}{}
+					return result, nil
+				}},
+				"child": {ParseFunc: func(ctx *spider.Context) (spider.ParseResult, error) {
+					return spider.ParseResult{}, nil
+				}},
+			},
+		},
+	})
+
+	f := &fakeFetcher{}
+	storage := &fakeStorage{}
+	task := spider.NewTask(
+		spider.WithName("test_shutdown"),
+		spider.WithFetcher(f),
+		spider.WithStorage(storage),
+		spider.WithWaitTime(1),
+	)
+	task.Limit = rate.NewLimiter(rate.Inf, 1)
+
+	frontier := filepath.Join(t.TempDir(), "frontier.jsonl")
+	e := NewEngine(
+		WithWorkCount(2),
+		WithSeeds([]*spider.Task{task}),
+		WithScheduler(NewSchedule()),
+		WithFrontierPath(frontier),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		e.Run(ctx)
+		close(done)
+	}()
+
+	<-saved
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("crawler did not stop")
+	}
+
+	assert.True(t, storage.flushed)
+	assert.Len(t, storage.saved, 1)
+
+	file, err := os.Open(frontier)
+	assert.Nil(t, err)
+	defer file.Close()
+	pending := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		pending++
+	}
+	// 每个子请求要么已经抓取，要么被保存到 frontier 中
+	assert.Equal(t, childCount+1, len(f.fetched)+pending)
+}
+
+func TestCrawler_RunComplete(t *testing.T) {
+	Store.Add(&spider.Task{
+		Options: spider.Options{Name: "test_complete"},
+		Rule: spider.RuleTree{
+			Root: func() ([]*spider.Request, error) {
+				return []*spider.Request{{URL: "http://root", Method: "GET", RuleName: "root"}}, nil
+			},
+			Trunk: map[string]*spider.Rule{
+				"root": {ParseFunc: func(ctx *spider.Context) (spider.ParseResult, error) {
+					return spider.ParseResult{Requesrts: []*spider.Request{
+						{Task: ctx.Req.Task, URL: "http://child", Method: "GET", Depth: ctx.Req.Depth + 1, RuleName: "child"},
+					}}, nil
+				}},
+				"child": {ParseFunc: func(ctx *spider.Context) (spider.ParseResult, error) {
+					// 指回已经抓取过的页面
+					return spider.ParseResult{Requesrts: []*spider.Request{
+						{Task: ctx.Req.Task, URL: "http://root", Method: "GET", Depth: ctx.Req.Depth + 1, RuleName: "root"},
+					}}, nil
+				}},
+			},
+		},
+	})
+
+	task := spider.NewTask(
+		spider.WithName("test_complete"),
+		spider.WithFetcher(&fakeFetcher{}),
+		spider.WithStorage(&fakeStorage{}),
+		spider.WithWaitTime(1),
+	)
+	task.Limit = rate.NewLimiter(rate.Inf, 1)
+
+	var events []TaskState
+	e := NewEngine(
+		WithWorkCount(2),
+		WithSeeds([]*spider.Task{task}),
+		WithScheduler(NewSchedule()),
+		WithTaskListener(func(e TaskEvent) {
+			events = append(events, e.State)
+		}),
+	)
+
+	done := make(chan struct{})
+	go func() {
+		e.Run(context.Background())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("crawler did not finish")
+	}
+
+	status := e.TaskStatus()
+	assert.Len(t, status, 1)
+	assert.Equal(t, TaskCompleted, status[0].State)
+	assert.Equal(t, 2, status[0].Succeeded)
+	assert.Equal(t, 1, status[0].Skipped)
+	assert.Equal(t, 0, status[0].Outstanding)
+	assert.Equal(t, []TaskState{TaskRunning, TaskCompleted}, events)
+}
+
+func TestCrawler_InvalidValidation(t *testing.T) {
+	Store.Add(&spider.Task{
+		Options: spider.Options{Name: "test_invalid_validation"},
+		Rule: spider.RuleTree{
+			Root: func() ([]*spider.Request, error) {
+				return []*spider.Request{{URL: "http://root", Method: "GET", RuleName: "root"}}, nil
+			},
+			Trunk: map[string]*spider.Rule{
+				"root": {Validation: &spider.Validation{RequiredSelectors: []string{"div["}}},
+			},
+		},
+	})
+
+	f := &fakeFetcher{}
+	task := spider.NewTask(
+		spider.WithName("test_invalid_validation"),
+		spider.WithFetcher(f),
+		spider.WithStorage(&fakeStorage{}),
+	)
+	e := NewEngine(
+		WithWorkCount(1),
+		WithSeeds([]*spider.Task{task}),
+		WithScheduler(NewSchedule()),
+	)
+
+	done := make(chan struct{})
+	go func() {
+		e.Run(context.Background())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("crawler did not finish")
+	}
+
+	// 校验规则有误的任务不会发出任何请求
+	assert.Equal(t, TaskFailed, e.TaskStatus()[0].State)
+	assert.Empty(t, f.fetched)
+}
+
+func TestCrawler_BannedErrorPage(t *testing.T) {
+	Store.Add(&spider.Task{
+		Options: spider.Options{Name: "test_banned_error_page"},
+		Rule: spider.RuleTree{
+			Root: func() ([]*spider.Request, error) {
+				return []*spider.Request{{URL: "http://root", Method: "GET", RuleName: "root"}}, nil
+			},
+			Trunk: map[string]*spider.Rule{
+				"root": {Validation: &spider.Validation{BanPatterns: []string{"captcha"}}},
+			},
+		},
+	})
+
+	var banned []*spider.Response
+	task := spider.NewTask(
+		spider.WithName("test_banned_error_page"),
+		spider.WithFetcher(spider.FetchFunc(func(req *spider.Request) (*spider.Response, error) {
+			return nil, &spider.StatusError{Code: 403, Response: &spider.Response{StatusCode: 403, URL: req.URL, Body: []byte("captcha")}}
+		})),
+		spider.WithStorage(&fakeStorage{}),
+		spider.WithBanHandler(func(req *spider.Request, resp *spider.Response) {
+			banned = append(banned, resp)
+		}),
+	)
+	task.Retry = spider.RetryPolicy{MaxAttempts: 1}
+	e := NewEngine(
+		WithWorkCount(1),
+		WithSeeds([]*spider.Task{task}),
+		WithScheduler(NewSchedule()),
+	)
+
+	done := make(chan struct{})
+	go func() {
+		e.Run(context.Background())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("crawler did not finish")
+	}
+
+	// 未配置封禁状态码时，根据错误页面的内容识别封禁，并将响应交给 OnBan
+	assert.Len(t, banned, 1)
+	assert.Equal(t, "captcha", string(banned[0].Body))
+	assert.Equal(t, 1, e.TaskStatus()[0].Banned)
+}
+
+type fakeRobots func(url string) (bool, error)
+
+func (f fakeRobots) Allowed(ctx context.Context, url string) (bool, error) {
+	return f(url)
+}
+
+func TestCrawler_RobotsBlocked(t *testing.T) {
+	Store.Add(&spider.Task{
+		Options: spider.Options{Name: "test_robots"},
+		Rule: spider.RuleTree{
+			Root: func() ([]*spider.Request, error) {
+				return []*spider.Request{
+					{URL: "http://site/allowed", Method: "GET", RuleName: "page"},
+					{URL: "http://site/private", Method: "GET", RuleName: "page"},
+					{URL: "http://flaky/page", Method: "GET", RuleName: "page"},
+				}, nil
+			},
+			Trunk: map[string]*spider.Rule{
+				"page": {ParseFunc: func(ctx *spider.Context) (spider.ParseResult, error) {
+					return spider.ParseResult{}, nil
+				}},
+			},
+		},
+	})
+
+	f := &fakeFetcher{}
+	var unavailable int32
+	task := spider.NewTask(
+		spider.WithName("test_robots"),
+		spider.WithFetcher(f),
+		spider.WithWaitTime(0),
+		spider.WithRetry(spider.RetryPolicy{MaxAttempts: 2}),
+		spider.WithRobots(fakeRobots(func(url string) (bool, error) {
+			// 第一次获取 robots.txt 失败，重试后允许抓取
+			if strings.HasPrefix(url, "http://flaky") && atomic.AddInt32(&unavailable, 1) == 1 {
+				return false, spider.ErrRobotsUnavailable
+			}
+			return !strings.HasSuffix(url, "/private"), nil
+		})),
+	)
+
+	e := NewEngine(
+		WithWorkCount(1),
+		WithSeeds([]*spider.Task{task}),
+		WithScheduler(NewSchedule()),
+	)
+	done := make(chan struct{})
+	go func() {
+		e.Run(context.Background())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("crawler did not finish")
+	}
+
+	status := e.TaskStatus()[0]
+	assert.Equal(t, TaskCompleted, status.State)
+	assert.Equal(t, 2, status.Succeeded)
+	assert.Equal(t, 0, status.Failed)
+	assert.Equal(t, 1, status.Blocked)
+	assert.Equal(t, []string{"http://site/allowed", "http://flaky/page"}, f.fetched)
+}
+
+type etagFetcher struct {
+	lock       sync.Mutex
+	validators []spider.Validator
+	unchanged  chan struct{}
+}
+
+func (f *etagFetcher) Get(req *spider.Request) (*spider.Response, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.validators = append(f.validators, req.Validator)
+	if req.Validator.ETag == "v1" {
+		select {
+		case f.unchanged <- struct{}{}:
+		default:
+		}
+		return nil, spider.ErrNotModified
+	}
+	return &spider.Response{
+		StatusCode: 200,
+		Header:     http.Header{"Etag": []string{"v1"}},
+		URL:        req.URL,
+		Body:       []byte(strings.Repeat("a", 6000)),
+	}, nil
+}
+
+func TestCrawler_Revisit(t *testing.T) {
+	Store.Add(&spider.Task{
+		Options: spider.Options{Name: "test_revisit"},
+		Rule: spider.RuleTree{
+			Root: func() ([]*spider.Request, error) {
+				return []*spider.Request{{URL: "http://book", Method: "GET", RuleName: "book"}}, nil
+			},
+			Trunk: map[string]*spider.Rule{
+				"book": {
+					Revisit: 50 * time.Millisecond,
+					ParseFunc: func(ctx *spider.Context) (spider.ParseResult, error) {
+						return spider.ParseResult{}, nil
+					},
+				},
+			},
+		},
+	})
+
+	f := &etagFetcher{unchanged: make(chan struct{}, 1)}
+	task := spider.NewTask(
+		spider.WithName("test_revisit"),
+		spider.WithFetcher(f),
+		spider.WithWaitTime(0),
+	)
+	e := NewEngine(
+		WithWorkCount(1),
+		WithSeeds([]*spider.Task{task}),
+		WithScheduler(NewSchedule()),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		e.Run(ctx)
+		close(done)
+	}()
+
+	// 任务完成后仍然等待重新抓取，第二次抓取发送条件请求
+	select {
+	case <-f.unchanged:
+	case <-time.After(5 * time.Second):
+		t.Fatal("request was not revisited")
+	}
+	cancel()
+	<-done
+
+	status := e.TaskStatus()[0]
+	assert.Equal(t, 1, status.Succeeded)
+	assert.GreaterOrEqual(t, status.Unchanged, 1)
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	assert.Equal(t, spider.Validator{}, f.validators[0])
+	assert.Equal(t, "v1", f.validators[1].ETag)
+}
+
+func TestAddJsReq(t *testing.T) {
+	reqs := AddJsReq(map[string]interface{}{
+		"URL":      "http://a.com/api",
+		"RuleName": "list",
+		"Priority": int64(2),
+		"Header":   map[string]interface{}{"X-Token": "abc"},
+		"Query":    map[string]interface{}{"page": int64(1)},
+		"Form":     map[string]interface{}{"q": "go"},
+	})
+	assert.Len(t, reqs, 1)
+	req := reqs[0]
+	assert.Equal(t, "POST", req.Method)
+	assert.Equal(t, int64(2), req.Priority)
+	assert.Equal(t, "abc", req.Header.Get("X-Token"))
+	assert.Equal(t, "http://a.com/api?page=1", req.FullURL())
+	assert.Equal(t, "q=go", string(req.Body))
+
+	assert.Nil(t, AddJsReq(map[string]interface{}{"RuleName": "list"}))
+}
+
+func TestAddSitemap(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>http://a.com/book/1</loc><lastmod>2023-04-01</lastmod></url>
+  <url><loc>http://a.com/book/2</loc><lastmod>2021-04-01</lastmod></url>
+  <url><loc>http://a.com/tag/novel</loc></url>
+</urlset>`))
+	}))
+	defer server.Close()
+
+	store := &CrawlerStore{Hash: map[string]*spider.Task{}}
+	store.AddJSTask(&spider.TaskModle{Root: fmt.Sprintf(
+		`AddSitemap({URL: "%s/sitemap.xml", RuleName: "detail", Pattern: "/book/", Since: "2022-01-01", Priority: 3});`,
+		server.URL,
+	)})
+	reqs, err := store.list[0].Rule.Root()
+	assert.Nil(t, err)
+	assert.Len(t, reqs, 1)
+	assert.Equal(t, "http://a.com/book/1", reqs[0].URL)
+	assert.Equal(t, "detail", reqs[0].RuleName)
+	assert.Equal(t, int64(3), reqs[0].Priority)
+
+	// 参数有误时抛出 SitemapError
+	for _, root := range []string{
+		`AddSitemap({RuleName: "detail"});`,
+		fmt.Sprintf(`AddSitemap({URL: "%s/sitemap.xml", Since: "yesterday"});`, server.URL),
+	} {
+		store := &CrawlerStore{Hash: map[string]*spider.Task{}}
+		store.AddJSTask(&spider.TaskModle{Root: root})
+		_, err := store.list[0].Rule.Root()
+		assert.ErrorContains(t, err, "SitemapError", root)
+	}
+}
+
+func TestJSONFuncs(t *testing.T) {
+	store := &CrawlerStore{Hash: map[string]*spider.Task{}}
+	schema := &spider.Schema{Columns: []spider.Column{{Name: "title", Type: spider.TypeString}, {Name: "tags"}}}
+	store.AddJSTask(&spider.TaskModle{Rules: []spider.RuleModle{
+		{Name: "list", ParseFunc: `ParseJSON("detail", "data.items[*].url");`},
+		{Name: "items", Schema: schema, ParseFunc: `OutputJSON("data.items[*]", {title: "name", tags: "tags[*]"});`},
+		{Name: "count", Schema: schema, ParseFunc: `
+			var r = OutputJSON("data.items[*]", {title: "name"});
+			if (JSONPath("data.items[*]").length != 2) { throw new Error("bad count"); }
+			r;`},
+		{Name: "bad", ParseFunc: `ParseJSON("detail", "data[");`},
+	}})
+	task := store.list[0]
+	body := `jsonp_cb({"data": {"items": [{"name": "a", "url": "/item/1", "tags": ["x"]}, {"name": "b", "url": "http://b.com/2"}]}});`
+	parse := func(rule string) (spider.ParseResult, error) {
+		req := &spider.Request{Task: task, URL: "http://a.com/api?page=1", RuleName: rule}
+		return task.Rule.Trunk[rule].ParseFunc(&spider.Context{Body: []byte(body), Req: req})
+	}
+
+	res, err := parse("list")
+	assert.Nil(t, err)
+	assert.Len(t, res.Requesrts, 2)
+	assert.Equal(t, "http://a.com/item/1", res.Requesrts[0].URL)
+	assert.Equal(t, "detail", res.Requesrts[0].RuleName)
+	assert.Equal(t, int64(1), res.Requesrts[0].Depth)
+
+	res, err = parse("items")
+	assert.Nil(t, err)
+	assert.Len(t, res.Items, 2)
+	assert.Equal(t, map[string]interface{}{"title": "a", "tags": []interface{}{"x"}}, res.Items[0].(*spider.DataCell).Data)
+	assert.Equal(t, map[string]interface{}{"title": "b", "tags": []interface{}{}}, res.Items[1].(*spider.DataCell).Data)
+
+	res, err = parse("count")
+	assert.Nil(t, err)
+	assert.Len(t, res.Items, 2)
+
+	_, err = parse("bad")
+	assert.ErrorContains(t, err, "JSONError")
+}
+
+func TestCrawler_PollRedrive(t *testing.T) {
+	q, err := deadletter.New(t.TempDir())
+	assert.Nil(t, err)
+	task := spider.NewTask(spider.WithName("test_redrive"), spider.WithMaxDepth(5))
+	e := NewEngine(
+		WithSeeds([]*spider.Task{task}),
+		WithScheduler(NewSchedule()),
+		WithDeadLetter(q),
+		WithRedriveInterval(10*time.Millisecond),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go e.scheduler.Schedule(ctx)
+	go e.pollRedrive(ctx)
+
+	// 运行期间通过 CLI 重放的请求会被重新调度
+	err = q.Add(deadletter.Entry{
+		Request:  spider.RequestRecord{TaskName: "test_redrive", URL: "http://failed", Method: "GET"},
+		Attempts: 3,
+	})
+	assert.Nil(t, err)
+	n, err := q.Redrive(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	pulled := make(chan *spider.Request, 1)
+	go func() { pulled <- e.scheduler.Pull() }()
+	select {
+	case req := <-pulled:
+		assert.Equal(t, "http://failed", req.URL)
+		assert.Equal(t, task, req.Task)
+		assert.Equal(t, 0, req.Attempts)
+	case <-time.After(5 * time.Second):
+		t.Fatal("redrive request not scheduled")
+	}
+	assert.Equal(t, 1, e.TaskStatus()[0].Outstanding)
+}
@@ -0,0 +1,73 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"go.uber.org/zap"
+	"gocrawler/spider"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// 将停止时尚未抓取的请求保存到 frontierPath
+func (e *Crawler) saveFrontier(reqs []*spider.Request) error {
+	if e.frontierPath == "" || len(reqs) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(e.frontierPath), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(e.frontierPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	for _, req := range reqs {
+		if err := enc.Encode(req.Record()); err != nil {
+			return err
+		}
+	}
+	return f.Sync()
+}
+
+// 加载上次停止时保存的请求，加载后删除文件
+func (e *Crawler) loadFrontier() []*spider.Request {
+	if e.frontierPath == "" {
+		return nil
+	}
+	f, err := os.Open(e.frontierPath)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			e.Logger.Error("open frontier failed", zap.Error(err))
+		}
+		return nil
+	}
+	defer f.Close()
+
+	var reqs []*spider.Request
+	dec := json.NewDecoder(f)
+	for dec.More() {
+		var rec spider.RequestRecord
+		if err := dec.Decode(&rec); err != nil {
+			e.Logger.Error("decode frontier failed", zap.Error(err))
+			return nil
+		}
+		task := e.findSeed(rec.TaskName)
+		if task == nil {
+			e.Logger.Error("can not find task of frontier request",
+				zap.String("task name", rec.TaskName),
+				zap.String("url", rec.URL),
+			)
+			continue
+		}
+		reqs = append(reqs, rec.Request(task))
+	}
+	if err := os.Remove(e.frontierPath); err != nil {
+		e.Logger.Error("remove frontier failed", zap.Error(err))
+	}
+	e.Logger.Info("load frontier", zap.Int("count", len(reqs)))
+	return reqs
+}
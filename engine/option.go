@@ -2,23 +2,34 @@ package engine
 
 import (
 	"go.uber.org/zap"
+	"gocrawler/deadletter"
+	"gocrawler/dedup"
+	"gocrawler/revisit"
 	"gocrawler/spider"
+	"time"
 )
 
 type Option func(opts *options)
 
 type options struct {
-	WorkCount   int
-	Fetcher     spider.Fetcher
-	Storage     spider.Storage
-	Logger      *zap.Logger
-	Seeds       []*spider.Task
-	registryURL string
-	scheduler   Scheduler
+	WorkCount     int
+	Fetcher       spider.Fetcher
+	Storage       spider.Storage
+	Logger        *zap.Logger
+	Seeds         []*spider.Task
+	registryURL   string
+	scheduler     Scheduler
+	deduper       dedup.Deduper
+	revisitStore  revisit.Store
+	deadLetter    *deadletter.Queue
+	redriveEvery  time.Duration
+	frontierPath  string
+	taskListeners []TaskListener
 }
 
 var defaultOptions = options{
-	Logger: zap.NewNop(),
+	Logger:       zap.NewNop(),
+	redriveEvery: 30 * time.Second,
 }
 
 func WithStorage(s spider.Storage) Option {
@@ -61,3 +72,45 @@ func WithScheduler(scheduler Scheduler) Option {
 		opts.scheduler = scheduler
 	}
 }
+
+// 设置请求去重器，默认使用内存去重
+func WithDeduper(d dedup.Deduper) Option {
+	return func(opts *options) {
+		opts.deduper = d
+	}
+}
+
+// 设置保存 ETag、Last-Modified 等抓取记录的存储，用于增量抓取，默认保存在内存中
+func WithRevisitStore(s revisit.Store) Option {
+	return func(opts *options) {
+		opts.revisitStore = s
+	}
+}
+
+// 设置失败队列，超过重试次数的请求会写入其中
+func WithDeadLetter(q *deadletter.Queue) Option {
+	return func(opts *options) {
+		opts.deadLetter = q
+	}
+}
+
+// 设置运行期间检查重放队列的间隔，小于等于 0 时只在启动时加载
+func WithRedriveInterval(d time.Duration) Option {
+	return func(opts *options) {
+		opts.redriveEvery = d
+	}
+}
+
+// 设置停止时保存未抓取请求的文件路径，为空时不保存
+func WithFrontierPath(path string) Option {
+	return func(opts *options) {
+		opts.frontierPath = path
+	}
+}
+
+// 监听任务状态变更，例如任务完成
+func WithTaskListener(l TaskListener) Option {
+	return func(opts *options) {
+		opts.taskListeners = append(opts.taskListeners, l)
+	}
+}
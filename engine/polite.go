@@ -0,0 +1,268 @@
+package engine
+
+import (
+	"context"
+	"gocrawler/spider"
+	"math/rand"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// 处理完成后需要得到通知的调度器
+type Releaser interface {
+	Release(*spider.Request)
+}
+
+// 单个域名的抓取限制
+type HostPolicy struct {
+	MaxConns int           // 同时抓取的最大请求数
+	MinDelay time.Duration // 两次请求之间的最小间隔
+	Jitter   time.Duration // 在最小间隔上增加的随机时间
+	MaxQueue int           // 最多暂存的请求数量，超出的请求放回内部调度器
+}
+
+const defaultMaxQueue = 100
+
+// PoliteSchedule 按域名限制抓取频率的调度器
+// 从内部调度器中取出的请求按域名暂存，只有当域名的并发数与请求间隔都满足要求时才会分发给 worker，
+// 某个域名处于冷却期间时，会优先分发其他域名的请求，worker 不会因为等待而阻塞。
+// 每个域名暂存的请求数量有上限，已满域名的请求会放回内部调度器，继续取出其他域名的请求；
+// 内部调度器中只剩已满域名的请求时暂停取出，直到有请求分发、释放、冷却结束或有新请求加入
+type PoliteSchedule struct {
+	dispatcher
+	inner     Scheduler
+	policy    HostPolicy
+	hosts     map[string]*hostState
+	overrides map[string]HostPolicy // 特定域名的限制
+	deferred  map[*spider.Request]bool
+	paused    bool
+	innerCh   chan *spider.Request
+	releaseCh chan *spider.Request
+	pushCh    chan struct{}
+}
+
+type hostState struct {
+	policy   HostPolicy
+	inflight int
+	next     time.Time // 允许发出下一个请求的时间
+	queue    []*spider.Request
+}
+
+func (h *hostState) ready(now time.Time) bool {
+	return len(h.queue) > 0 && h.inflight < h.policy.MaxConns && !now.Before(h.next)
+}
+
+func NewPoliteSchedule(inner Scheduler, policy HostPolicy, overrides map[string]HostPolicy) *PoliteSchedule {
+	if policy.MaxConns <= 0 {
+		policy.MaxConns = 1
+	}
+	if policy.MaxQueue <= 0 {
+		policy.MaxQueue = defaultMaxQueue
+	}
+	s := &PoliteSchedule{
+		dispatcher: newDispatcher(),
+		inner:      inner,
+		policy:     policy,
+		hosts:      make(map[string]*hostState),
+		overrides:  make(map[string]HostPolicy, len(overrides)),
+		deferred:   make(map[*spider.Request]bool),
+		innerCh:    make(chan *spider.Request),
+		releaseCh:  make(chan *spider.Request),
+		pushCh:     make(chan struct{}, 1),
+	}
+	for host, p := range overrides {
+		if p.MaxConns <= 0 {
+			p.MaxConns = policy.MaxConns
+		}
+		if p.MaxQueue <= 0 {
+			p.MaxQueue = policy.MaxQueue
+		}
+		s.overrides[strings.ToLower(host)] = p
+	}
+	return s
+}
+
+func (s *PoliteSchedule) Push(reqs ...*spider.Request) {
+	s.inner.Push(reqs...)
+	select {
+	case s.pushCh <- struct{}{}:
+	default:
+	}
+}
+
+func (s *PoliteSchedule) Pending() []*spider.Request {
+	return append(s.dispatcher.Pending(), s.inner.Pending()...)
+}
+
+func (s *PoliteSchedule) Restored() map[string]int {
+	if r, ok := s.inner.(Restorer); ok {
+		return r.Restored()
+	}
+	return nil
+}
+
+// worker 处理完请求后释放域名的并发数
+func (s *PoliteSchedule) Release(req *spider.Request) {
+	select {
+	case s.releaseCh <- req:
+	case <-s.done:
+	}
+}
+
+func (s *PoliteSchedule) Schedule(ctx context.Context) {
+	go s.inner.Schedule(ctx)
+	fed := make(chan struct{})
+	go s.feed(ctx, fed)
+
+	defer func() {
+		<-fed
+		for _, h := range s.hosts {
+			s.stop(h.queue...)
+			h.queue = nil
+		}
+		close(s.done)
+	}()
+
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		now := time.Now()
+		var req *spider.Request
+		var ch chan *spider.Request
+		var host *hostState
+		var wakeup time.Time
+		for name, h := range s.hosts {
+			if len(h.queue) == 0 && h.inflight == 0 && now.After(h.next) {
+				delete(s.hosts, name)
+				continue
+			}
+			if h.ready(now) {
+				host, req, ch = h, h.queue[0], s.workerCh
+				break
+			}
+			// 记录最早结束冷却的域名
+			if len(h.queue) > 0 && h.inflight < h.policy.MaxConns && (wakeup.IsZero() || h.next.Before(wakeup)) {
+				wakeup = h.next
+			}
+		}
+
+		var timerCh <-chan time.Time
+		if req == nil && !wakeup.IsZero() {
+			resetTimer(timer, wakeup.Sub(now))
+			timerCh = timer.C
+		}
+
+		var innerCh chan *spider.Request
+		if !s.paused {
+			innerCh = s.innerCh
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case r := <-innerCh:
+			h := s.host(r)
+			if len(h.queue) < h.policy.MaxQueue {
+				h.queue = append(h.queue, r)
+				continue
+			}
+			// 再次取到放回过的请求，说明内部调度器中已没有其他域名可以接收的请求
+			if s.deferred[r] {
+				s.paused = true
+			}
+			s.deferred[r] = true
+			s.inner.Push(r)
+			continue
+		case ch <- req:
+			host.queue = host.queue[1:]
+			host.inflight++
+			host.next = now.Add(max(host.policy.MinDelay, crawlDelay(req)))
+			if host.policy.Jitter > 0 {
+				host.next = host.next.Add(time.Duration(rand.Int63n(int64(host.policy.Jitter))))
+			}
+		case r := <-s.releaseCh:
+			if h, ok := s.hosts[hostOf(r)]; ok && h.inflight > 0 {
+				h.inflight--
+				// 首个请求分发时 robots.txt 可能尚未获取，处理完成后再按 Crawl-delay 延后
+				if next := time.Now().Add(crawlDelay(r)); next.After(h.next) {
+					h.next = next
+				}
+			}
+		case <-timerCh:
+		case <-s.pushCh:
+		}
+		s.resume()
+	}
+}
+
+// 状态发生变化后重新从内部调度器中取出请求
+func (s *PoliteSchedule) resume() {
+	s.paused = false
+	if len(s.deferred) > 0 {
+		s.deferred = make(map[*spider.Request]bool)
+	}
+}
+
+// 不断从内部调度器中取出请求
+func (s *PoliteSchedule) feed(ctx context.Context, fed chan struct{}) {
+	defer close(fed)
+	for {
+		r := s.inner.Pull()
+		if r == nil {
+			return
+		}
+		select {
+		case s.innerCh <- r:
+		case <-ctx.Done():
+			// 等待内部调度器停止，保证停止后 Pending 能取到全部请求
+			for ; r != nil; r = s.inner.Pull() {
+				s.stop(r)
+			}
+			return
+		}
+	}
+}
+
+func (s *PoliteSchedule) host(req *spider.Request) *hostState {
+	name := hostOf(req)
+	h, ok := s.hosts[name]
+	if !ok {
+		policy, ok := s.overrides[name]
+		if !ok {
+			policy = s.policy
+		}
+		h = &hostState{policy: policy}
+		s.hosts[name] = h
+	}
+	return h
+}
+
+// 请求所属任务的 robots.txt 中为该域名声明的 Crawl-delay
+func crawlDelay(req *spider.Request) time.Duration {
+	if req.Task == nil {
+		return 0
+	}
+	if d, ok := req.Task.Robots.(spider.CrawlDelayer); ok {
+		return d.CrawlDelay(req.URL)
+	}
+	return 0
+}
+
+func hostOf(req *spider.Request) string {
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+func resetTimer(t *time.Timer, d time.Duration) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+	t.Reset(d)
+}
@@ -0,0 +1,137 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"gocrawler/spider"
+	"testing"
+	"time"
+)
+
+func TestPoliteSchedule(t *testing.T) {
+	task := &spider.Task{Options: spider.Options{Name: "polite", Weight: 1}}
+	s := NewPoliteSchedule(NewSchedule(), HostPolicy{MaxConns: 1, MinDelay: time.Hour}, map[string]HostPolicy{
+		"fast.example.com": {MaxConns: 2},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Schedule(ctx)
+
+	s.Push(
+		&spider.Request{Task: task, URL: "http://slow.example.com/1"},
+		&spider.Request{Task: task, URL: "http://slow.example.com/2"},
+		&spider.Request{Task: task, URL: "http://fast.example.com/1"},
+		&spider.Request{Task: task, URL: "http://fast.example.com/2"},
+		&spider.Request{Task: task, URL: "http://fast.example.com/3"},
+	)
+
+	// slow 域名冷却期间，仍然可以分发 fast 域名的请求
+	got := map[string]int{}
+	var fast []*spider.Request
+	for i := 0; i < 3; i++ {
+		r := s.Pull()
+		h := hostOf(r)
+		got[h]++
+		if h == "fast.example.com" {
+			fast = append(fast, r)
+		}
+	}
+	assert.Equal(t, map[string]int{"slow.example.com": 1, "fast.example.com": 2}, got)
+
+	// fast 域名达到并发上限，释放后才能继续分发
+	select {
+	case r := <-s.workerCh:
+		t.Fatalf("unexpected request %s", r.URL)
+	case <-time.After(50 * time.Millisecond):
+	}
+	s.Release(fast[0])
+	assert.Equal(t, "http://fast.example.com/3", s.Pull().URL)
+
+	cancel()
+	<-s.done
+	assert.Nil(t, s.Pull())
+	assert.Len(t, s.Pending(), 1)
+}
+
+func TestPoliteSchedule_MaxQueue(t *testing.T) {
+	task := &spider.Task{Options: spider.Options{Name: "polite", Weight: 1}}
+	s := NewPoliteSchedule(NewSchedule(), HostPolicy{MaxConns: 1, MinDelay: time.Hour, MaxQueue: 2}, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Schedule(ctx)
+
+	for i := 0; i < 10; i++ {
+		s.Push(&spider.Request{Task: task, URL: fmt.Sprintf("http://slow.example.com/%d", i)})
+	}
+	s.Push(&spider.Request{Task: task, URL: "http://fast.example.com/1"})
+
+	// slow 域名暂存已满且处于冷却中，排在其后的 fast 域名请求仍然可以分发
+	got := map[string]int{}
+	for i := 0; i < 2; i++ {
+		pulled := make(chan *spider.Request, 1)
+		go func() { pulled <- s.Pull() }()
+		select {
+		case r := <-pulled:
+			got[hostOf(r)]++
+		case <-time.After(5 * time.Second):
+			t.Fatal("fast host starved by slow host")
+		}
+	}
+	assert.Equal(t, map[string]int{"slow.example.com": 1, "fast.example.com": 1}, got)
+
+	// 之后只剩冷却中的 slow 域名，不再分发请求
+	select {
+	case r := <-s.workerCh:
+		t.Fatalf("unexpected request %s", r.URL)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	cancel()
+	<-s.done
+	assert.Len(t, s.Pending(), 9)
+}
+
+type delayRobots map[string]time.Duration
+
+func (d delayRobots) Allowed(ctx context.Context, url string) (bool, error) {
+	return true, nil
+}
+
+func (d delayRobots) CrawlDelay(url string) time.Duration {
+	return d[hostOf(&spider.Request{URL: url})]
+}
+
+func TestPoliteSchedule_CrawlDelay(t *testing.T) {
+	task := &spider.Task{Options: spider.Options{Name: "polite", Weight: 1}}
+	task.Robots = delayRobots{"a.example.com": time.Hour}
+	s := NewPoliteSchedule(NewSchedule(), HostPolicy{MaxConns: 1}, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Schedule(ctx)
+
+	s.Push(
+		&spider.Request{Task: task, URL: "http://a.example.com/1"},
+		&spider.Request{Task: task, URL: "http://a.example.com/2"},
+		&spider.Request{Task: task, URL: "http://b.example.com/1"},
+		&spider.Request{Task: task, URL: "http://b.example.com/2"},
+	)
+
+	// Crawl-delay 只作用于声明它的域名
+	got := map[string]int{}
+	for i := 0; i < 3; i++ {
+		r := s.Pull()
+		got[hostOf(r)]++
+		s.Release(r)
+	}
+	assert.Equal(t, map[string]int{"a.example.com": 1, "b.example.com": 2}, got)
+	select {
+	case r := <-s.workerCh:
+		t.Fatalf("unexpected request %s", r.URL)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	cancel()
+	<-s.done
+	assert.Len(t, s.Pending(), 1)
+}
@@ -0,0 +1,149 @@
+package engine
+
+import (
+	"container/heap"
+	"context"
+	"gocrawler/spider"
+)
+
+// PrioritySchedule 基于堆的优先级调度器
+// 每个任务拥有独立的优先级队列，按照 Request.Priority 从大到小分发，优先级相同时先进先出；
+// 多个任务之间按照 Task.Weight 进行平滑加权轮询，避免单个大任务占满所有 worker
+type PrioritySchedule struct {
+	dispatcher
+	queues map[string]*taskQueue
+	order  []*taskQueue // 保证轮询顺序稳定
+	seq    uint64
+	count  int // 队列中的请求总数
+}
+
+func NewPrioritySchedule() *PrioritySchedule {
+	s := &PrioritySchedule{}
+	s.dispatcher = newDispatcher()
+	s.queues = make(map[string]*taskQueue)
+	return s
+}
+
+func (s *PrioritySchedule) Schedule(ctx context.Context) {
+	defer func() {
+		s.stop(s.drain()...)
+		close(s.done)
+	}()
+	for {
+		// 每轮重新选出下一个请求，保证新加入的高优先级请求能够优先分发
+		var req *spider.Request
+		var ch chan *spider.Request
+		q := s.peek()
+		if q != nil {
+			req = q.items[0].req
+			ch = s.workerCh
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case r := <-s.requestCh:
+			s.add(r)
+		case ch <- req:
+			s.pop(q)
+		}
+	}
+}
+
+func (s *PrioritySchedule) add(req *spider.Request) {
+	name := req.Task.Name
+	q, ok := s.queues[name]
+	if !ok {
+		q = &taskQueue{}
+		s.queues[name] = q
+		s.order = append(s.order, q)
+	}
+	// 权重可能在任务配置中变更，以最新请求所属任务为准
+	q.weight = req.Task.Weight
+	if q.weight <= 0 {
+		q.weight = 1
+	}
+	s.seq++
+	s.count++
+	heap.Push(q, &queueItem{req: req, seq: s.seq})
+}
+
+// 取出队列中的所有请求
+func (s *PrioritySchedule) drain() []*spider.Request {
+	reqs := make([]*spider.Request, 0, s.count)
+	for _, q := range s.order {
+		for q.Len() > 0 {
+			reqs = append(reqs, heap.Pop(q).(*queueItem).req)
+		}
+	}
+	s.count = 0
+	return reqs
+}
+
+// 按照平滑加权轮询选出下一个任务，不修改轮询状态
+func (s *PrioritySchedule) peek() *taskQueue {
+	var best *taskQueue
+	for _, q := range s.order {
+		if q.Len() == 0 {
+			continue
+		}
+		if best == nil || q.current+q.weight > best.current+best.weight {
+			best = q
+		}
+	}
+	return best
+}
+
+// 取出任务 q 中优先级最高的请求，并更新轮询状态
+func (s *PrioritySchedule) pop(q *taskQueue) *spider.Request {
+	total := 0
+	for _, o := range s.order {
+		if o.Len() == 0 {
+			continue
+		}
+		o.current += o.weight
+		total += o.weight
+	}
+	q.current -= total
+	s.count--
+	return heap.Pop(q).(*queueItem).req
+}
+
+type queueItem struct {
+	req *spider.Request
+	seq uint64 // 入队顺序
+}
+
+// 单个任务的优先级队列，实现 heap.Interface
+type taskQueue struct {
+	items   []*queueItem
+	weight  int
+	current int // 平滑加权轮询中的当前权重
+}
+
+func (q *taskQueue) Len() int {
+	return len(q.items)
+}
+
+func (q *taskQueue) Less(i, j int) bool {
+	if q.items[i].req.Priority != q.items[j].req.Priority {
+		return q.items[i].req.Priority > q.items[j].req.Priority
+	}
+	return q.items[i].seq < q.items[j].seq
+}
+
+func (q *taskQueue) Swap(i, j int) {
+	q.items[i], q.items[j] = q.items[j], q.items[i]
+}
+
+func (q *taskQueue) Push(x interface{}) {
+	q.items = append(q.items, x.(*queueItem))
+}
+
+func (q *taskQueue) Pop() interface{} {
+	n := len(q.items)
+	item := q.items[n-1]
+	q.items[n-1] = nil
+	q.items = q.items[:n-1]
+	return item
+}
@@ -0,0 +1,39 @@
+package engine
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"gocrawler/spider"
+	"testing"
+)
+
+func TestPrioritySchedule(t *testing.T) {
+	big := &spider.Task{Options: spider.Options{Name: "big", Weight: 2}}
+	small := &spider.Task{Options: spider.Options{Name: "small", Weight: 1}}
+
+	s := NewPrioritySchedule()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Schedule(ctx)
+
+	for i := 0; i < 6; i++ {
+		s.Push(&spider.Request{Task: big, URL: "big", Priority: 1})
+	}
+	s.Push(&spider.Request{Task: big, URL: "big-high", Priority: 100})
+	for i := 0; i < 3; i++ {
+		s.Push(&spider.Request{Task: small, URL: "small", Priority: 1})
+	}
+
+	var urls []string
+	for i := 0; i < 6; i++ {
+		urls = append(urls, s.Pull().URL)
+	}
+	assert.Equal(t, "big-high", urls[0])
+	// 按照 2:1 的权重交替分发
+	assert.Equal(t, []string{"big-high", "small", "big", "big", "small", "big"}, urls)
+
+	cancel()
+	<-s.done
+	assert.Nil(t, s.Pull())
+	assert.Len(t, s.Pending(), 4)
+}
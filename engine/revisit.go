@@ -0,0 +1,89 @@
+package engine
+
+import (
+	"go.uber.org/zap"
+	"gocrawler/revisit"
+	"gocrawler/spider"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 等待重新抓取的请求，同一个请求只保留一个定时器
+type revisitQueue struct {
+	timers  map[string]*time.Timer
+	reqs    map[string]*spider.Request
+	count   int64 // 等待中的请求数，不加锁读取，避免与 taskTracker 的锁形成环
+	stopped bool
+	lock    sync.Mutex
+}
+
+func newRevisitQueue() *revisitQueue {
+	return &revisitQueue{
+		timers: make(map[string]*time.Timer),
+		reqs:   make(map[string]*spider.Request),
+	}
+}
+
+// 等待 delay 后调用 push 重新抓取请求，已在等待中的请求会被忽略
+func (q *revisitQueue) Add(req *spider.Request, delay time.Duration, push func(...*spider.Request)) {
+	key := req.Unique()
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.stopped {
+		return
+	}
+	if _, ok := q.timers[key]; ok {
+		return
+	}
+	next := *req
+	next.Attempts = 0
+	next.Validator = spider.Validator{}
+	q.reqs[key] = &next
+	atomic.AddInt64(&q.count, 1)
+	q.timers[key] = time.AfterFunc(delay, func() {
+		q.lock.Lock()
+		defer q.lock.Unlock()
+		if q.stopped {
+			return
+		}
+		delete(q.timers, key)
+		delete(q.reqs, key)
+		push(&next)
+		// 放入调度器后再减少计数，保证任务重新进入运行状态前不会被判定为全部结束
+		atomic.AddInt64(&q.count, -1)
+	})
+}
+
+func (q *revisitQueue) Len() int {
+	return int(atomic.LoadInt64(&q.count))
+}
+
+// 停止所有定时器，返回尚未重新抓取的请求
+func (q *revisitQueue) Stop() []*spider.Request {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.stopped = true
+	reqs := make([]*spider.Request, 0, len(q.reqs))
+	for key, t := range q.timers {
+		t.Stop()
+		reqs = append(reqs, q.reqs[key])
+	}
+	q.timers = make(map[string]*time.Timer)
+	q.reqs = make(map[string]*spider.Request)
+	atomic.StoreInt64(&q.count, 0)
+	return reqs
+}
+
+// 记录抓取结果，并在 interval 后重新抓取
+func (e *Crawler) revisited(req *spider.Request, v spider.Validator, interval time.Duration) {
+	m := revisit.Meta{
+		ETag:         v.ETag,
+		LastModified: v.LastModified,
+		Fetched:      time.Now(),
+	}
+	if err := e.revisitStore.Put(req.Unique(), m); err != nil {
+		e.Logger.Error("save revisit meta failed", zap.Error(err))
+	}
+	e.revisits.Add(req, interval, e.push)
+}
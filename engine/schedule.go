@@ -1,14 +1,24 @@
 package engine
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"github.com/robertkrimen/otto"
 	"go.uber.org/zap"
+	"gocrawler/deadletter"
+	"gocrawler/dedup"
 	"gocrawler/parse/doubanbook"
 	"gocrawler/parse/doubangroup"
 	"gocrawler/parse/doubangroupjs"
+	"gocrawler/revisit"
+	"gocrawler/sitemap"
 	"gocrawler/spider"
+	"net/http"
+	"net/url"
 	"runtime/debug"
 	"sync"
+	"time"
 )
 
 func init() {
@@ -32,15 +42,10 @@ func AddJsReqs(jreqs []map[string]interface{}) []*spider.Request {
 	reqs := make([]*spider.Request, 0)
 
 	for _, jreq := range jreqs {
-		req := &spider.Request{}
-		u, ok := jreq["Url"].(string)
-		if !ok {
+		req := jsReq(jreq)
+		if req == nil {
 			return nil
 		}
-		req.URL = u
-		req.RuleName, _ = jreq["RuleName"].(string)
-		req.Method, _ = jreq["Method"].(string)
-		req.Priority, _ = jreq["Priority"].(int64)
 		reqs = append(reqs, req)
 	}
 	return reqs
@@ -48,18 +53,133 @@ func AddJsReqs(jreqs []map[string]interface{}) []*spider.Request {
 
 // 用于动态规则添加请求。
 func AddJsReq(jreq map[string]interface{}) []*spider.Request {
-	reqs := make([]*spider.Request, 0)
-	req := &spider.Request{}
-	u, ok := jreq["Url"].(string)
-	if !ok {
+	req := jsReq(jreq)
+	if req == nil {
 		return nil
 	}
-	req.URL = u
+	return []*spider.Request{req}
+}
+
+// 将 JS 对象转换为请求，支持 URL(或 Url)、RuleName、Method、Priority、Session，
+// 以及 Header、Query、Cookie 对象和 Body 字符串、Form 对象、JSON 对象三种请求体
+func jsReq(jreq map[string]interface{}) *spider.Request {
+	u, ok := jreq["URL"].(string)
+	if !ok {
+		if u, ok = jreq["Url"].(string); !ok {
+			return nil
+		}
+	}
+	req := &spider.Request{URL: u}
 	req.RuleName, _ = jreq["RuleName"].(string)
 	req.Method, _ = jreq["Method"].(string)
-	req.Priority, _ = jreq["Priority"].(int64)
-	reqs = append(reqs, req)
-	return reqs
+	req.Session, _ = jreq["Session"].(string)
+	switch p := jreq["Priority"].(type) {
+	case int64:
+		req.Priority = p
+	case float64:
+		req.Priority = int64(p)
+	}
+	for k, v := range jsObject(jreq["Header"]) {
+		if req.Header == nil {
+			req.Header = make(http.Header)
+		}
+		req.Header.Set(k, v)
+	}
+	for k, v := range jsObject(jreq["Query"]) {
+		if req.Query == nil {
+			req.Query = make(url.Values)
+		}
+		req.Query.Set(k, v)
+	}
+	for k, v := range jsObject(jreq["Cookie"]) {
+		req.AddCookie(k, v)
+	}
+	if body, ok := jreq["Body"].(string); ok {
+		req.Body = []byte(body)
+	}
+	if form := jsObject(jreq["Form"]); form != nil {
+		values := make(url.Values, len(form))
+		for k, v := range form {
+			values.Set(k, v)
+		}
+		req.SetForm(values)
+	}
+	if data, ok := jreq["JSON"]; ok {
+		if err := req.SetJSON(data); err != nil {
+			return nil
+		}
+	}
+	return req
+}
+
+func jsObject(v interface{}) map[string]string {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	res := make(map[string]string, len(m))
+	for k, v := range m {
+		res[k] = fmt.Sprint(v)
+	}
+	return res
+}
+
+// 用于动态规则通过 sitemap 生成种子请求，支持 URL、RuleName、Pattern、Since(2006-01-02)、Priority
+func AddSitemapReqs(jcfg map[string]interface{}) ([]*spider.Request, error) {
+	u, ok := jcfg["URL"].(string)
+	if !ok {
+		return nil, errors.New("sitemap URL is required")
+	}
+	rule, _ := jcfg["RuleName"].(string)
+	var opts []sitemap.Option
+	if pattern, ok := jcfg["Pattern"].(string); ok {
+		opts = append(opts, sitemap.WithPattern(pattern))
+	}
+	if since, ok := jcfg["Since"].(string); ok && since != "" {
+		t, err := time.Parse("2006-01-02", since)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, sitemap.WithSince(t))
+	}
+	switch p := jcfg["Priority"].(type) {
+	case int64:
+		opts = append(opts, sitemap.WithPriority(p))
+	case float64:
+		opts = append(opts, sitemap.WithPriority(int64(p)))
+	}
+	return sitemap.New(u, rule, opts...).Root()
+}
+
+// 为动态规则注册 JSON 解析函数，出错时抛出 JSONError：
+// JSONPath(path) 选择 JSON 中的值；ParseJSON(ruleName, path) 将选择的地址转换为请求；
+// OutputJSON(path, fields) 将选择的对象转换为 item，fields 为字段到对象内路径的映射，省略时取对象中与 schema 同名的字段，
+// 规则需要通过 schema 声明 item 的字段
+func setJSONFuncs(vm *otto.Otto, ctx *spider.Context) {
+	throw := func(err error) {
+		panic(vm.MakeCustomError("JSONError", err.Error()))
+	}
+	vm.Set("JSONPath", func(path string) []interface{} {
+		values, err := ctx.JSONPath(path)
+		if err != nil {
+			throw(err)
+		}
+		return values
+	})
+	vm.Set("ParseJSON", func(ruleName string, path string) spider.ParseResult {
+		reqs, err := ctx.JSONRequests(path, ruleName)
+		if err != nil {
+			throw(err)
+		}
+		return spider.ParseResult{Requesrts: reqs}
+	})
+	vm.Set("OutputJSON", func(path string, fields map[string]interface{}) spider.ParseResult {
+		items, err := ctx.JSONItems(path, jsObject(fields))
+		if err != nil {
+			throw(err)
+		}
+		return spider.ParseResult{Items: items}
+	})
 }
 
 func (c *CrawlerStore) AddJSTask(m *spider.TaskModle) {
@@ -70,6 +190,13 @@ func (c *CrawlerStore) AddJSTask(m *spider.TaskModle) {
 	task.Rule.Root = func() ([]*spider.Request, error) {
 		vm := otto.New()
 		vm.Set("AddJsReq", AddJsReqs)
+		vm.Set("AddSitemap", func(jcfg map[string]interface{}) []*spider.Request {
+			reqs, err := AddSitemapReqs(jcfg)
+			if err != nil {
+				panic(vm.MakeCustomError("SitemapError", err.Error()))
+			}
+			return reqs
+		})
 		v, err := vm.Eval(m.Root)
 		if err != nil {
 			return nil, err
@@ -86,6 +213,7 @@ func (c *CrawlerStore) AddJSTask(m *spider.TaskModle) {
 			return func(ctx *spider.Context) (spider.ParseResult, error) {
 				vm := otto.New()
 				vm.Set("ctx", ctx)
+				setJSONFuncs(vm, ctx)
 				v, err := vm.Eval(parse)
 				if err != nil {
 					return spider.ParseResult{}, err
@@ -103,9 +231,16 @@ func (c *CrawlerStore) AddJSTask(m *spider.TaskModle) {
 		if task.Rule.Trunk == nil {
 			task.Rule.Trunk = make(map[string]*spider.Rule, 0)
 		}
-		task.Rule.Trunk[r.Name] = &spider.Rule{
-			ParseFunc: paesrFunc,
+		rule := &spider.Rule{
+			Validation: r.Validation,
+			Extract:    r.Extract,
+			Schema:     r.Schema,
+			Paginate:   r.Paginate,
+		}
+		if r.ParseFunc != "" {
+			rule.ParseFunc = paesrFunc
 		}
+		task.Rule.Trunk[r.Name] = rule
 	}
 
 	c.Hash[task.Name] = task
@@ -119,7 +254,7 @@ var Store = &CrawlerStore{
 }
 
 func GetFields(taskName string, ruleName string) []string {
-	return Store.Hash[taskName].Rule.Trunk[ruleName].ItemFields
+	return Store.Hash[taskName].Rule.Trunk[ruleName].Fields()
 }
 
 type CrawlerStore struct {
@@ -128,27 +263,32 @@ type CrawlerStore struct {
 }
 
 type Crawler struct {
-	out         chan spider.ParseResult
-	Visited     map[string]bool // 存储请求访问信息，Visited 中的 Key 是请求的唯一标识，URL + method，并使用 MD5 生成唯一键
-	VisitedLock sync.Mutex      // 确保并发安全
-
-	failures    map[string]*spider.Request // 失败请求id -> 失败请求
-	failureLock sync.Mutex
+	out      chan spider.ParseResult
+	delayed  *delayQueue   // 等待重试的请求
+	revisits *revisitQueue // 等待重新抓取的请求
+	tracker  *taskTracker  // 任务状态
+	cancel   context.CancelFunc
 
 	options
 }
 
 type Scheduler interface {
-	Schedule()
+	Schedule(ctx context.Context) // 启动调度，ctx 取消后停止
 	Push(...*spider.Request)
-	Pull() *spider.Request
+	Pull() *spider.Request      // 调度器停止后返回 nil
+	Pending() []*spider.Request // 调度器停止后返回尚未分发的请求
+}
+
+// 启动时会从持久化存储中恢复请求的调度器
+// 恢复的请求没有经过 Crawler 放入调度器，需要单独计入任务的待处理请求
+type Restorer interface {
+	Restored() map[string]int // 任务名 -> 恢复的请求数量
 }
 
 type Schedule struct {
-	requestCh   chan *spider.Request // 接收请求
-	workerCh    chan *spider.Request // 分配任务给worker
-	priReqQueue []*spider.Request    // 优先队列
-	reqQueue    []*spider.Request    // 普通队列
+	dispatcher
+	priReqQueue []*spider.Request // 优先队列
+	reqQueue    []*spider.Request // 普通队列
 	Logger      *zap.Logger
 }
 
@@ -158,51 +298,82 @@ func NewEngine(opts ...Option) *Crawler {
 		opt(&options)
 	}
 	e := &Crawler{}
-	e.Visited = make(map[string]bool, 100)
+	if options.deduper == nil {
+		options.deduper = dedup.NewMemory()
+	}
+	if options.revisitStore == nil {
+		options.revisitStore = revisit.NewMemory()
+	}
 	e.out = make(chan spider.ParseResult)
-	e.failures = make(map[string]*spider.Request)
+	e.delayed = newDelayQueue()
+	e.revisits = newRevisitQueue()
+	e.tracker = newTaskTracker()
+	e.tracker.listeners = options.taskListeners
 	e.options = options
+	for _, task := range options.Seeds {
+		e.tracker.Register(task.Name)
+	}
 	return e
 }
 
 func NewSchedule() *Schedule {
 	s := &Schedule{}
-	requestCh := make(chan *spider.Request)
-	workerCh := make(chan *spider.Request)
-	s.requestCh = requestCh
-	s.workerCh = workerCh
+	s.dispatcher = newDispatcher()
 	return s
 }
 
-func (e *Crawler) Run() {
-	go e.Schedule()
-	for i := 0; i < e.WorkCount; i++ {
-		go e.CreateWork()
+// 运行爬虫直到 ctx 取消或所有任务结束
+// 停止后不再分发新的请求，等待正在抓取的请求完成并保存结果，
+// 随后刷新存储缓冲区，并将尚未抓取的请求持久化，下次启动时重新加载
+func (e *Crawler) Run(ctx context.Context) {
+	ctx, e.cancel = context.WithCancel(ctx)
+	defer e.cancel()
+	e.tracker.lock.Lock()
+	e.tracker.allDone = func() {
+		if n := e.revisits.Len(); n > 0 {
+			e.Logger.Info("all tasks finished, waiting for revisits", zap.Int("revisits", n))
+			return
+		}
+		e.Logger.Info("all tasks finished")
+		e.cancel()
 	}
-	e.HandleResult()
-}
+	e.tracker.lock.Unlock()
 
-// 将请求放入到调度器中
-func (s *Schedule) Push(reqs ...*spider.Request) {
-	for _, req := range reqs {
-		s.requestCh <- req
+	e.Schedule(ctx)
+
+	var wg sync.WaitGroup
+	for i := 0; i < e.WorkCount; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e.CreateWork(ctx)
+		}()
 	}
-}
+	go func() {
+		wg.Wait()
+		close(e.out)
+	}()
 
-// 从调度器中获取请求
-func (s *Schedule) Pull() *spider.Request {
-	r := <-s.workerCh
-	return r
+	e.HandleResult()
+	e.shutdown()
 }
 
 func (s *Schedule) Output() *spider.Request {
-	r := <-s.workerCh
-	return r
+	return s.Pull()
 }
 
-func (s *Schedule) Schedule() {
+func (s *Schedule) Schedule(ctx context.Context) {
 	var req *spider.Request
 	var ch chan *spider.Request
+	defer func() {
+		if req != nil {
+			s.stop(req)
+		}
+		s.stop(s.priReqQueue...)
+		s.stop(s.reqQueue...)
+		s.priReqQueue, s.reqQueue = nil, nil
+		close(s.done)
+	}()
 	for {
 		if req == nil && len(s.priReqQueue) > 0 {
 			req = s.priReqQueue[0]
@@ -215,19 +386,9 @@ func (s *Schedule) Schedule() {
 			ch = s.workerCh
 		}
 
-		// 请求校验
-		if req != nil {
-			if err := req.Check(); err != nil {
-				zap.L().Debug("check failed",
-					zap.Error(err),
-				)
-				req = nil
-				ch = nil
-				continue
-			}
-		}
-
 		select {
+		case <-ctx.Done():
+			return
 		case r := <-s.requestCh:
 			if r.Priority > 0 {
 				s.priReqQueue = append(s.priReqQueue, r)
@@ -243,7 +404,7 @@ func (s *Schedule) Schedule() {
 }
 
 // 启动调度器
-func (c *Crawler) Schedule() {
+func (c *Crawler) Schedule(ctx context.Context) {
 	var reqs []*spider.Request
 
 	for _, task := range c.Seeds {
@@ -253,12 +414,21 @@ func (c *Crawler) Schedule() {
 			continue
 		}
 		task.Rule = t.Rule
+		// 校验、提取或分页规则有误时所有请求都会失败，不启动该任务
+		if err := task.Compile(); err != nil {
+			c.Logger.Error("invalid task rules",
+				zap.String("task name", task.Name),
+				zap.Error(err),
+			)
+			c.tracker.Fail(task.Name)
+			continue
+		}
 		rootreqs, err := task.Rule.Root()
 		if err != nil {
 			c.Logger.Error("get root failed",
 				zap.Error(err),
 			)
-
+			c.tracker.Fail(task.Name)
 			continue
 		}
 		for _, req := range rootreqs {
@@ -266,11 +436,43 @@ func (c *Crawler) Schedule() {
 		}
 		reqs = append(reqs, rootreqs...)
 	}
-	go c.scheduler.Schedule()
-	go c.scheduler.Push(reqs...)
+	reqs = append(reqs, c.loadRedrive()...)
+	reqs = append(reqs, c.loadFrontier()...)
+	if r, ok := c.scheduler.(Restorer); ok {
+		for name, n := range r.Restored() {
+			c.tracker.Add(name, n)
+		}
+	}
+	go c.scheduler.Schedule(ctx)
+	go func() {
+		c.push(reqs...)
+		for _, task := range c.Seeds {
+			c.tracker.Seeded(task.Name)
+		}
+	}()
+	if c.deadLetter != nil && c.redriveEvery > 0 {
+		go c.pollRedrive(ctx)
+	}
 }
 
-func (s *Crawler) CreateWork() {
+// 校验请求后放入调度器，并记录到所属任务的待处理请求中
+func (c *Crawler) push(reqs ...*spider.Request) {
+	valid := make([]*spider.Request, 0, len(reqs))
+	for _, req := range reqs {
+		if err := req.Check(); err != nil {
+			c.Logger.Debug("check failed",
+				zap.Error(err),
+				zap.String("url", req.URL),
+			)
+			continue
+		}
+		c.tracker.Add(req.Task.Name, 1)
+		valid = append(valid, req)
+	}
+	c.scheduler.Push(valid...)
+}
+
+func (s *Crawler) CreateWork(ctx context.Context) {
 	defer func() {
 		if err := recover(); err != nil {
 			s.Logger.Error("worker panic",
@@ -280,107 +482,342 @@ func (s *Crawler) CreateWork() {
 	}()
 	for {
 		req := s.scheduler.Pull()
-		if err := req.Check(); err != nil {
-			s.Logger.Error("check failed",
-				zap.Error(err),
-			)
-			continue
+		if req == nil {
+			return
+		}
+		if !s.handle(ctx, req) {
+			return
 		}
-		if !req.Task.Reload && s.HasVisited(req) {
+	}
+}
+
+// 处理单个请求，返回 false 时 worker 退出
+func (s *Crawler) handle(ctx context.Context, req *spider.Request) bool {
+	if r, ok := s.scheduler.(Releaser); ok {
+		defer r.Release(req)
+	}
+	if s.tracker.Park(req) {
+		return true
+	}
+	if err := req.Check(); err != nil {
+		s.Logger.Error("check failed",
+			zap.Error(err),
+		)
+		s.tracker.Done(req.Task.Name, false)
+		return true
+	}
+	interval := req.Task.RevisitInterval(req.RuleName)
+	var meta revisit.Meta
+	var fetched bool
+	if interval > 0 {
+		meta, fetched = s.revisitStore.Get(req.Unique())
+	}
+	if !req.Task.Reload && s.HasVisited(req) {
+		// 需要定期重新抓取的请求，到期后继续抓取
+		if !fetched || time.Since(meta.Fetched) < interval {
 			s.Logger.Debug("request has visited",
 				zap.String("url:", req.URL),
 			)
-			continue
+			if fetched {
+				s.revisits.Add(req, interval-time.Since(meta.Fetched), s.push)
+			}
+			s.tracker.Skipped(req.Task.Name)
+			return true
 		}
-		s.StoreVisited(req)
+	}
+	if fetched {
+		req.Validator = spider.Validator{ETag: meta.ETag, LastModified: meta.LastModified}
+	}
+	s.StoreVisited(req)
 
-		body, err := req.Fetch()
-		if err != nil {
-			s.Logger.Error("can't fetch ",
-				zap.Error(err),
-				zap.String("url", req.URL),
-			)
-			s.SetFailure(req)
-			continue
+	resp, err := req.Fetch(ctx)
+	if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+		// 尚未发出请求便已停止，放回调度器等待持久化
+		if err := s.deduper.Delete(req.Unique()); err != nil {
+			s.Logger.Error("delete visited failed", zap.Error(err))
 		}
-
-		if len(body) < 6000 {
-			s.Logger.Error("can't fetch ",
-				zap.Int("length", len(body)),
-				zap.String("url", req.URL),
-			)
-			s.SetFailure(req)
-			continue
+		s.scheduler.Push(req)
+		return false
+	}
+	if errors.Is(err, spider.ErrDisallowed) {
+		s.Logger.Info("blocked by robots.txt",
+			zap.String("url", req.URL),
+		)
+		s.tracker.Blocked(req.Task.Name)
+		return true
+	}
+	if errors.Is(err, spider.ErrNotModified) {
+		s.Logger.Debug("not modified",
+			zap.String("url", req.URL),
+		)
+		s.revisited(req, req.Validator, interval)
+		s.tracker.Unchanged(req.Task.Name)
+		return true
+	}
+	validation := req.Task.Validation(req.RuleName)
+	if err != nil {
+		s.Logger.Error("can't fetch ",
+			zap.Error(err),
+			zap.String("url", req.URL),
+		)
+		// 错误状态码的响应同样可能是封禁页面
+		eresp := spider.ErrorResponse(err)
+		if validation.BannedStatus(spider.StatusCode(err)) || bannedPage(validation, eresp) {
+			s.banned(req, eresp)
 		}
+		s.SetFailure(req, err)
+		return true
+	}
 
-		rule := req.Task.Rule.Trunk[req.RuleName]
-		result, err := rule.ParseFunc(&spider.Context{
-			body,
-			req,
-		})
-		if err != nil {
-			s.Logger.Error("ParseFunc failed ",
-				zap.Error(err),
-				zap.String("url", req.URL),
-			)
-			continue
+	if err := validation.Validate(resp); err != nil {
+		s.Logger.Error("validate failed",
+			zap.Error(err),
+			zap.String("url", req.URL),
+		)
+		var ve *spider.ValidationError
+		if errors.As(err, &ve) && ve.Banned {
+			s.banned(req, resp)
+		} else {
+			s.tracker.Invalid(req.Task.Name, false)
 		}
+		s.SetFailure(req, err)
+		return true
+	}
 
-		if len(result.Requesrts) > 0 {
-			go s.scheduler.Push(result.Requesrts...)
-		}
+	rule := req.Task.Rule.Trunk[req.RuleName]
+	pctx := &spider.Context{
+		Body: resp.Body,
+		Req:  req,
+		Resp: resp,
+	}
+	result, err := rule.Parse(pctx)
+	if errors.Is(err, spider.ErrPaginate) {
+		// 分页失败时仍然保存当前页的结果
+		s.Logger.Error("paginate failed",
+			zap.Error(err),
+			zap.String("url", req.URL),
+		)
+	} else if err != nil {
+		s.Logger.Error("parse failed",
+			zap.Error(err),
+			zap.String("url", req.URL),
+		)
+		s.tracker.Done(req.Task.Name, false)
+		return true
+	}
+
+	if len(result.Requesrts) > 0 {
+		s.push(result.Requesrts...)
+	}
+
+	s.out <- result
+	if interval > 0 {
+		s.revisited(req, resp.Validator(), interval)
+	}
+	s.tracker.Done(req.Task.Name, true)
+	return true
+}
 
-		s.out <- result
+func bannedPage(v *spider.Validation, resp *spider.Response) bool {
+	if resp == nil {
+		return false
+	}
+	var ve *spider.ValidationError
+	return errors.As(v.Validate(resp), &ve) && ve.Banned
+}
+
+// 记录封禁，并通知任务将使用的代理或 Cookie 标记为不可用
+func (s *Crawler) banned(req *spider.Request, resp *spider.Response) {
+	s.tracker.Invalid(req.Task.Name, true)
+	for _, f := range req.Task.OnBan {
+		f(req, resp)
 	}
 }
 
 func (s *Crawler) HandleResult() {
-	for {
-		select {
-		case result := <-s.out:
-			for _, item := range result.Items {
-				switch d := item.(type) {
-				case *spider.DataCell:
-					name := d.GetTaskName()
-					task := Store.Hash[name]
-					task.Storage.Save(d)
+	for result := range s.out {
+		for _, item := range result.Items {
+			switch d := item.(type) {
+			case *spider.DataCell:
+				storage := s.Storage
+				if d.Task != nil && d.Task.Storage != nil {
+					storage = d.Task.Storage
+				}
+				if err := storage.Save(d); err != nil {
+					s.Logger.Error("save data failed", zap.Error(err))
 				}
-				s.Logger.Sugar().Info("get result: ", item)
 			}
+			s.Logger.Sugar().Info("get result: ", item)
 		}
 	}
 }
 
+// 停止后的清理工作
+func (e *Crawler) shutdown() {
+	flushed := make(map[spider.Storage]struct{})
+	storages := []spider.Storage{e.Storage}
+	for _, task := range e.Seeds {
+		storages = append(storages, task.Storage)
+	}
+	for _, storage := range storages {
+		if storage == nil {
+			continue
+		}
+		if _, ok := flushed[storage]; ok {
+			continue
+		}
+		flushed[storage] = struct{}{}
+		if err := storage.Flush(); err != nil {
+			e.Logger.Error("flush storage failed", zap.Error(err))
+		}
+	}
+
+	pending := e.delayed.Stop()
+	pending = append(pending, e.revisits.Stop()...)
+	pending = append(pending, e.tracker.TakeParked()...)
+	pending = append(pending, e.scheduler.Pending()...)
+	if err := e.saveFrontier(pending); err != nil {
+		e.Logger.Error("save frontier failed", zap.Error(err))
+	}
+
+	if err := e.deduper.Close(); err != nil {
+		e.Logger.Error("close deduper failed", zap.Error(err))
+	}
+	if err := e.revisitStore.Close(); err != nil {
+		e.Logger.Error("close revisit store failed", zap.Error(err))
+	}
+	e.Logger.Info("crawler stopped", zap.Int("pending", len(pending)))
+}
+
+// 请求是否已访问，Key 是请求的唯一标识，URL + method，并使用 MD5 生成唯一键
 func (e *Crawler) HasVisited(r *spider.Request) bool {
-	e.VisitedLock.Lock()
-	defer e.VisitedLock.Unlock()
-	unique := r.Unique()
-	return e.Visited[unique]
+	return e.deduper.Visited(r.Unique())
 }
 
 func (e *Crawler) StoreVisited(reqs ...*spider.Request) {
-	e.VisitedLock.Lock()
-	defer e.VisitedLock.Unlock()
-
+	keys := make([]string, 0, len(reqs))
 	for _, r := range reqs {
-		unique := r.Unique()
-		e.Visited[unique] = true
+		keys = append(keys, r.Unique())
+	}
+	if err := e.deduper.Store(keys...); err != nil {
+		e.Logger.Error("store visited failed", zap.Error(err))
 	}
 }
 
-func (e *Crawler) SetFailure(req *spider.Request) {
+func (e *Crawler) SetFailure(req *spider.Request, err error) {
 	if !req.Task.Reload {
-		e.VisitedLock.Lock()
-		unique := req.Unique()
-		delete(e.Visited, unique)
-		e.VisitedLock.Unlock()
-	}
-	e.failureLock.Lock()
-	defer e.failureLock.Unlock()
-	if _, ok := e.failures[req.Unique()]; !ok {
-		// 首次失败时，再重新执行一次
-		e.failures[req.Unique()] = req
-		e.scheduler.Push(req)
-	}
-	// todo: 失败2次，加载到失败队列中
+		if err := e.deduper.Delete(req.Unique()); err != nil {
+			e.Logger.Error("delete visited failed", zap.Error(err))
+		}
+	}
+
+	req.Attempts++
+	policy := req.Task.Retry
+	if policy.ShouldRetry(err, req.Attempts) {
+		delay := policy.Backoff(req.Attempts)
+		// 服务端通过 Retry-After 要求的等待时间更长时以其为准
+		if d := spider.RetryAfter(err); d > delay {
+			delay = d
+		}
+		e.Logger.Debug("retry request",
+			zap.String("url", req.URL),
+			zap.Int("attempts", req.Attempts),
+			zap.Duration("delay", delay),
+		)
+		e.delayed.Add(req, delay, e.scheduler.Push)
+		return
+	}
+
+	// 不再重试，加载到失败队列中
+	e.Logger.Error("request failed",
+		zap.Error(err),
+		zap.String("url", req.URL),
+		zap.Int("attempts", req.Attempts),
+	)
+	e.tracker.Done(req.Task.Name, false)
+	if e.deadLetter == nil {
+		return
+	}
+	entry := deadletter.Entry{
+		Request:    req.Record(),
+		Error:      err.Error(),
+		StatusCode: spider.StatusCode(err),
+		Attempts:   req.Attempts,
+		Time:       time.Now(),
+	}
+	if err := e.deadLetter.Add(entry); err != nil {
+		e.Logger.Error("add dead letter failed", zap.Error(err))
+	}
+}
+
+// 加载通过 CLI 重放的失败请求
+func (e *Crawler) loadRedrive() []*spider.Request {
+	if e.deadLetter == nil {
+		return nil
+	}
+	entries, err := e.deadLetter.TakeRedrive()
+	if err != nil {
+		e.Logger.Error("load redrive requests failed", zap.Error(err))
+		return nil
+	}
+	reqs := make([]*spider.Request, 0, len(entries))
+	for _, entry := range entries {
+		task := e.findSeed(entry.Request.TaskName)
+		if task == nil {
+			e.Logger.Error("can not find task of redrive request",
+				zap.String("task name", entry.Request.TaskName),
+				zap.String("url", entry.Request.URL),
+			)
+			continue
+		}
+		req := entry.Request.Request(task)
+		req.Attempts = 0
+		reqs = append(reqs, req)
+	}
+	return reqs
+}
+
+// 运行期间定时加载通过 CLI 重放的请求，无需重启 worker
+func (e *Crawler) pollRedrive(ctx context.Context) {
+	ticker := time.NewTicker(e.redriveEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if reqs := e.loadRedrive(); len(reqs) > 0 {
+				e.Logger.Info("load redrive requests", zap.Int("count", len(reqs)))
+				e.push(reqs...)
+			}
+		}
+	}
+}
+
+func (e *Crawler) findSeed(name string) *spider.Task {
+	for _, task := range e.Seeds {
+		if task.Name == name {
+			return task
+		}
+	}
+	return nil
+}
+
+// 返回所有任务的状态
+func (e *Crawler) TaskStatus() []TaskStatus {
+	return e.tracker.Status()
+}
+
+// 暂停任务，暂停期间拉取到的请求会被暂存，恢复后重新放入调度器
+func (e *Crawler) PauseTask(name string) error {
+	return e.tracker.Pause(name)
+}
+
+func (e *Crawler) ResumeTask(name string) error {
+	reqs, err := e.tracker.Resume(name)
+	if err != nil {
+		return err
+	}
+	e.scheduler.Push(reqs...)
+	return nil
 }
@@ -0,0 +1,291 @@
+package engine
+
+import (
+	"errors"
+	"gocrawler/spider"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 任务的生命周期状态
+type TaskState string
+
+const (
+	TaskPending   TaskState = "pending"   // 已添加，尚未生成种子请求
+	TaskRunning   TaskState = "running"   // 存在尚未处理完成的请求
+	TaskPaused    TaskState = "paused"    // 暂停中，拉取到的请求会被暂存
+	TaskCompleted TaskState = "completed" // 所有请求均已处理完成
+	TaskFailed    TaskState = "failed"    // 种子生成失败，或所有请求均失败
+)
+
+// 任务是否已结束
+func (s TaskState) Terminal() bool {
+	return s == TaskCompleted || s == TaskFailed
+}
+
+type TaskStatus struct {
+	Name        string    `json:"name"`
+	State       TaskState `json:"state"`
+	Outstanding int       `json:"outstanding"` // 尚未处理完成的请求数，包括等待重试与暂存的请求
+	Succeeded   int       `json:"succeeded"`
+	Failed      int       `json:"failed"`
+	Blocked     int       `json:"blocked"`   // 被 robots.txt 禁止抓取的请求数
+	Unchanged   int       `json:"unchanged"` // 重新抓取时服务端返回 304 的请求数
+	Skipped     int       `json:"skipped"`   // 已经抓取过而跳过的请求数
+	Invalid     int       `json:"invalid"`   // 内容校验失败的次数，重试前的失败也会计入
+	Banned      int       `json:"banned"`    // 遇到封禁页面或封禁状态码的次数
+	StartTime   time.Time `json:"start_time,omitempty"`
+	EndTime     time.Time `json:"end_time,omitempty"`
+}
+
+// 任务状态变更事件
+type TaskEvent struct {
+	Name  string
+	State TaskState
+	Time  time.Time
+}
+
+// 监听任务状态变更，在持有锁时同步调用，不能阻塞
+type TaskListener func(TaskEvent)
+
+var ErrTaskNotFound = errors.New("task not found")
+
+// 跟踪每个任务尚未处理完成的请求数，并维护任务状态
+type taskTracker struct {
+	tasks     map[string]*TaskStatus
+	parked    map[string][]*spider.Request // 暂停任务的请求
+	listeners []TaskListener
+	allDone   func() // 所有任务结束后调用
+	lock      sync.Mutex
+}
+
+func newTaskTracker() *taskTracker {
+	return &taskTracker{
+		tasks:  make(map[string]*TaskStatus),
+		parked: make(map[string][]*spider.Request),
+	}
+}
+
+func (t *taskTracker) Register(name string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if _, ok := t.tasks[name]; !ok {
+		t.tasks[name] = &TaskStatus{Name: name, State: TaskPending}
+	}
+}
+
+// 任务新增 n 个待处理的请求
+func (t *taskTracker) Add(name string, n int) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	s, ok := t.tasks[name]
+	if !ok {
+		return
+	}
+	s.Outstanding += n
+	if s.State == TaskPending || s.State.Terminal() {
+		s.EndTime = time.Time{}
+		if s.StartTime.IsZero() {
+			s.StartTime = time.Now()
+		}
+		t.transit(s, TaskRunning)
+	}
+}
+
+// 任务的一个请求处理完成
+func (t *taskTracker) Done(name string, success bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	s, ok := t.tasks[name]
+	if !ok {
+		return
+	}
+	s.Outstanding--
+	if success {
+		s.Succeeded++
+	} else {
+		s.Failed++
+	}
+	t.checkFinished(s)
+}
+
+// 任务的一个请求被 robots.txt 禁止抓取，不计入失败
+func (t *taskTracker) Blocked(name string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	s, ok := t.tasks[name]
+	if !ok {
+		return
+	}
+	s.Outstanding--
+	s.Blocked++
+	t.checkFinished(s)
+}
+
+// 任务的一个请求重新抓取时没有变化
+func (t *taskTracker) Unchanged(name string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	s, ok := t.tasks[name]
+	if !ok {
+		return
+	}
+	s.Outstanding--
+	s.Unchanged++
+	t.checkFinished(s)
+}
+
+// 任务的一个请求已经抓取过，跳过且不计入成功
+func (t *taskTracker) Skipped(name string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	s, ok := t.tasks[name]
+	if !ok {
+		return
+	}
+	s.Outstanding--
+	s.Skipped++
+	t.checkFinished(s)
+}
+
+// 记录一次内容校验失败或封禁，请求随后按照重试策略处理
+func (t *taskTracker) Invalid(name string, banned bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	s, ok := t.tasks[name]
+	if !ok {
+		return
+	}
+	if banned {
+		s.Banned++
+	} else {
+		s.Invalid++
+	}
+}
+
+// 任务失败，例如无法生成种子请求
+func (t *taskTracker) Fail(name string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if s, ok := t.tasks[name]; ok {
+		s.EndTime = time.Now()
+		t.transit(s, TaskFailed)
+		t.checkAllDone()
+	}
+}
+
+// 种子请求推送完成后检查，处理没有任何种子请求的任务
+func (t *taskTracker) Seeded(name string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if s, ok := t.tasks[name]; ok && s.State == TaskPending {
+		s.StartTime = time.Now()
+		s.State = TaskRunning
+		t.checkFinished(s)
+	}
+}
+
+func (t *taskTracker) checkFinished(s *TaskStatus) {
+	if s.Outstanding > 0 || s.State != TaskRunning {
+		return
+	}
+	s.EndTime = time.Now()
+	if s.Succeeded == 0 && s.Failed > 0 {
+		t.transit(s, TaskFailed)
+	} else {
+		t.transit(s, TaskCompleted)
+	}
+	t.checkAllDone()
+}
+
+func (t *taskTracker) checkAllDone() {
+	for _, s := range t.tasks {
+		if !s.State.Terminal() {
+			return
+		}
+	}
+	if t.allDone != nil {
+		t.allDone()
+	}
+}
+
+func (t *taskTracker) transit(s *TaskStatus, state TaskState) {
+	if s.State == state {
+		return
+	}
+	s.State = state
+	e := TaskEvent{Name: s.Name, State: state, Time: time.Now()}
+	for _, l := range t.listeners {
+		l(e)
+	}
+}
+
+// 任务暂停时暂存请求，返回是否已暂存
+func (t *taskTracker) Park(req *spider.Request) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	s, ok := t.tasks[req.Task.Name]
+	if !ok || s.State != TaskPaused {
+		return false
+	}
+	t.parked[s.Name] = append(t.parked[s.Name], req)
+	return true
+}
+
+func (t *taskTracker) Pause(name string) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	s, ok := t.tasks[name]
+	if !ok {
+		return ErrTaskNotFound
+	}
+	if s.State != TaskRunning {
+		return errors.New("task is not running")
+	}
+	t.transit(s, TaskPaused)
+	return nil
+}
+
+// 恢复任务，返回暂停期间暂存的请求
+func (t *taskTracker) Resume(name string) ([]*spider.Request, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	s, ok := t.tasks[name]
+	if !ok {
+		return nil, ErrTaskNotFound
+	}
+	if s.State != TaskPaused {
+		return nil, errors.New("task is not paused")
+	}
+	t.transit(s, TaskRunning)
+	reqs := t.parked[name]
+	delete(t.parked, name)
+	t.checkFinished(s)
+	return reqs, nil
+}
+
+// 返回所有暂存的请求，用于停止时持久化
+func (t *taskTracker) TakeParked() []*spider.Request {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	var reqs []*spider.Request
+	for name, parked := range t.parked {
+		reqs = append(reqs, parked...)
+		delete(t.parked, name)
+	}
+	return reqs
+}
+
+func (t *taskTracker) Status() []TaskStatus {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	status := make([]TaskStatus, 0, len(t.tasks))
+	for _, s := range t.tasks {
+		status = append(status, *s)
+	}
+	sort.Slice(status, func(i, j int) bool {
+		return status[i].Name < status[j].Name
+	})
+	return status
+}
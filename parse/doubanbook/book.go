@@ -7,6 +7,12 @@ import (
 	"strconv"
 )
 
+// 豆瓣触发反爬时会重定向到 /misc/sorry
+var validation = &spider.Validation{
+	MinSize: 6000,
+	BanURLs: []string{`douban\.com/misc/sorry`},
+}
+
 var DoubanBookTask = &spider.Task{
 	Options: spider.Options{Name: "douban_book_list"},
 	Rule: spider.RuleTree{
@@ -23,42 +29,37 @@ var DoubanBookTask = &spider.Task{
 			return roots, nil
 		},
 		Trunk: map[string]*spider.Rule{
-			"数据tag": {ParseFunc: ParseTag},
-			"书籍列表":  {ParseFunc: ParseBookList},
+			"数据tag": {ParseFunc: ParseTag, Validation: validation},
+			"书籍列表":  {ParseFunc: ParseBookList, Validation: validation},
 			"书籍简介": {
-				ItemFields: []string{
-					"书名",
-					"作者",
-					"页数",
-					"出版社",
-					"得分",
-					"价格",
-					"简介",
-				},
+				Validation: validation,
+				Schema: &spider.Schema{Columns: []spider.Column{
+					{Name: "书名", Type: spider.TypeString, Required: true, MaxLength: 255},
+					{Name: "作者", Type: spider.TypeString, MaxLength: 255},
+					{Name: "页数", Type: spider.TypeInt},
+					{Name: "出版社", Type: spider.TypeString, MaxLength: 255},
+					{Name: "得分", Type: spider.TypeString, MaxLength: 16},
+					{Name: "价格", Type: spider.TypeString, MaxLength: 64},
+					{Name: "简介", Type: spider.TypeString},
+				}},
 				ParseFunc: ParseBookDetail,
 			},
 		},
 	},
 }
 
-const regexpStr = `<a href="([^"]+)" class="tag">([^<]+)</a>`
+var tagLinks = &spider.LinkExtractor{
+	CSS:      "a.tag",
+	Allow:    []string{`^https://book\.douban\.com/tag/`},
+	RuleName: "书籍列表",
+}
 
 func ParseTag(ctx *spider.Context) (spider.ParseResult, error) {
-	re := regexp.MustCompile(regexpStr)
-
-	matches := re.FindAllSubmatch(ctx.Body, -1)
-	result := spider.ParseResult{}
-
-	for _, m := range matches {
-		result.Requesrts = append(
-			result.Requesrts, &spider.Request{
-				Method:   "GET",
-				Task:     ctx.Req.Task,
-				URL:      "https://book.douban.com" + string(m[1]),
-				Depth:    ctx.Req.Depth + 1,
-				RuleName: "书籍列表",
-			})
+	reqs, err := ctx.Follow(tagLinks)
+	if err != nil {
+		return spider.ParseResult{}, err
 	}
+	result := spider.ParseResult{Requesrts: reqs}
 
 	zap.S().Debugln("parse book tag,count:", len(result.Requesrts))
 	// 在添加limit之前，临时减少抓取数量,防止被服务器封禁
@@ -116,7 +117,10 @@ func ParseBookDetail(ctx *spider.Context) (spider.ParseResult, error) {
 		"价格":  ExtraString(ctx.Body, priceRe),
 		"简介":  ExtraString(ctx.Body, intoRe),
 	}
-	data := ctx.Output(book)
+	data, err := ctx.Output(book)
+	if err != nil {
+		return spider.ParseResult{}, err
+	}
 
 	result := spider.ParseResult{
 		Items: []interface{}{data},
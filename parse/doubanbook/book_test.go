@@ -0,0 +1,34 @@
+package doubanbook
+
+import (
+	"github.com/stretchr/testify/assert"
+	"gocrawler/cache"
+	"gocrawler/spider"
+	"testing"
+)
+
+// 使用 testdata/cache 中录制的页面测试解析规则，不访问豆瓣
+func TestParse(t *testing.T) {
+	c, err := cache.New("testdata/cache", cache.Replay, 0)
+	assert.Nil(t, err)
+
+	res, err := c.Parse(&spider.Request{Task: DoubanBookTask, URL: "https://book.douban.com", Method: "GET", RuleName: "数据tag"})
+	assert.Nil(t, err)
+	assert.Len(t, res.Requesrts, 2)
+	assert.Equal(t, "https://book.douban.com/tag/%E5%B0%8F%E8%AF%B4", res.Requesrts[0].URL)
+
+	req := &spider.Request{Task: DoubanBookTask, URL: "https://book.douban.com/subject/1084336/", Method: "GET", RuleName: "书籍简介", TmpData: &spider.Temp{}}
+	req.TmpData.Set("book_name", "小王子")
+	res, err = c.Parse(req)
+	assert.Nil(t, err)
+	book := res.Items[0].(*spider.DataCell).Data
+	assert.Equal(t, "小王子", book["书名"])
+	assert.Equal(t, "[法] 圣埃克苏佩里", book["作者"])
+	assert.Equal(t, 97, book["页数"])
+	assert.Equal(t, "人民文学出版社", book["出版社"])
+	assert.Equal(t, " 22.00元", book["价格"])
+	assert.Equal(t, "小王子是一个超凡脱俗的仙童。", book["简介"])
+
+	_, err = c.Parse(&spider.Request{Task: DoubanBookTask, URL: "https://book.douban.com/subject/1/", Method: "GET", RuleName: "书籍简介"})
+	assert.ErrorIs(t, err, cache.ErrMiss)
+}
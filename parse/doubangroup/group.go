@@ -1,7 +1,6 @@
 package doubangroup
 
 import (
-	"fmt"
 	"gocrawler/spider"
 	"regexp"
 )
@@ -9,6 +8,20 @@ import (
 const urlListRe = `(https://www.douban.com/group/topic/[0-9a-z]+/)"[^>]*>([^<]+)</a>`
 const ContentRe = `<div class="topic-content">[\s\S]*?阳台[\s\S]*?<div class="aside">`
 
+// 豆瓣触发反爬时会重定向到 /misc/sorry
+var validation = &spider.Validation{
+	MinSize: 6000,
+	BanURLs: []string{`douban\.com/misc/sorry`},
+}
+
+// 讨论列表每页 25 条，没有新的帖子时停止翻页
+var discussion = &spider.Pagination{
+	Template: "https://www.douban.com/group/szsh/discussion?start={offset}",
+	Start:    1,
+	Step:     25,
+	MaxPages: 10,
+}
+
 var DoubangroupTask = &spider.Task{
 	//Property: spider.Property{
 	//	Name:     "find_douban_sun_room",
@@ -18,22 +31,16 @@ var DoubangroupTask = &spider.Task{
 	//},
 	Rule: spider.RuleTree{
 		Root: func() ([]*spider.Request, error) {
-			var roots []*spider.Request
-			for i := 0; i < 25; i += 25 {
-				str := fmt.Sprintf("https://www.douban.com/group/szsh/discussion?start=%d", i)
-				roots = append(roots, &spider.Request{
-					Priority: 1,
-					URL:      str,
-					Method:   "GET",
-					RuleName: "解析网站URL",
-				})
+			root, err := discussion.First("解析网站URL")
+			if err != nil {
+				return nil, err
 			}
-
-			return roots, nil
+			root.Priority = 1
+			return []*spider.Request{root}, nil
 		},
 		Trunk: map[string]*spider.Rule{
-			"解析网站URL": {ParseFunc: ParseURL},
-			"解析阳台房":   {ParseFunc: GetSunRoom},
+			"解析网站URL": {ParseFunc: ParseURL, Validation: validation, Paginate: discussion},
+			"解析阳台房":   {ParseFunc: GetSunRoom, Validation: validation},
 		},
 	},
 }
@@ -2,6 +2,12 @@ package doubangroupjs
 
 import "gocrawler/spider"
 
+// 豆瓣触发反爬时会重定向到 /misc/sorry
+var validation = &spider.Validation{
+	MinSize: 6000,
+	BanURLs: []string{`douban\.com/misc/sorry`},
+}
+
 var DoubangroupJSTask = &spider.TaskModle{
 	Property: spider.Property{
 		Name:     "js_find_douban_sun_room",
@@ -25,13 +31,15 @@ var DoubangroupJSTask = &spider.TaskModle{
 			`,
 	Rules: []spider.RuleModle{
 		{
-			Name: "解析网站URL",
+			Name:       "解析网站URL",
+			Validation: validation,
 			ParseFunc: `
 			ctx.ParseJSReg("解析阳台房","(https://www.douban.com/group/topic/[0-9a-z]+/)\"[^>]*>([^<]+)</a>");
 			`,
 		},
 		{
-			Name: "解析阳台房",
+			Name:       "解析阳台房",
+			Validation: validation,
 			ParseFunc: `
 			//console.log("parse output");
 			ctx.OutputJS("<div class=\"topic-content\">[\\s\\S]*?阳台[\\s\\S]*?<div class=\"aside\">");
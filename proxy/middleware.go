@@ -0,0 +1,61 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"gocrawler/spider"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// 为请求选择代理，记录在 Request.Proxy 中，并根据结果更新代理的统计信息
+// 与会话池一起使用时，会话池的中间件需要在前面，才能按会话绑定代理
+// Fetcher 需要使用 Request.Proxy 指定的代理，例如 collect.BrowserFetch
+func (p *Pool) Middleware() spider.Middleware {
+	return func(next spider.Fetcher) spider.Fetcher {
+		return spider.FetchFunc(func(req *spider.Request) (*spider.Response, error) {
+			u, err := p.Select(req)
+			if err != nil {
+				return nil, err
+			}
+			// 记录在原请求上，封禁处理时可以找到对应的代理
+			req.Proxy = u.String()
+			start := time.Now()
+			resp, err := next.Get(req)
+			p.report(u, time.Since(start), err)
+			return resp, err
+		})
+	}
+}
+
+func (p *Pool) report(u *url.URL, latency time.Duration, err error) {
+	var se *spider.StatusError
+	switch {
+	case errors.Is(err, context.Canceled):
+	case errors.As(err, &se):
+		// 代理本身返回的错误
+		switch se.Code {
+		case http.StatusProxyAuthRequired, http.StatusBadGateway, http.StatusGatewayTimeout:
+			p.Failure(u)
+		default:
+			p.Success(u, latency)
+		}
+	case err == nil, errors.Is(err, spider.ErrNotModified):
+		p.Success(u, latency)
+	default:
+		p.Failure(u)
+	}
+}
+
+// 可以作为任务的 BanFunc 使用，隔离返回封禁页面的代理
+func (p *Pool) OnBan(req *spider.Request, resp *spider.Response) {
+	if req.Proxy == "" {
+		return
+	}
+	u, err := url.Parse(req.Proxy)
+	if err != nil {
+		return
+	}
+	p.Ban(u)
+}
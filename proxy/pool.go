@@ -0,0 +1,387 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 没有可用的代理
+var ErrNoProxy = errors.New("no available proxy")
+
+type Strategy string
+
+const (
+	Weighted Strategy = "weighted" // 按权重、成功率与延迟加权随机选择
+	LRU      Strategy = "lru"      // 选择最久没有使用的代理
+)
+
+type proxyState struct {
+	url         *url.URL
+	weight      int
+	successes   int
+	failures    int
+	consecutive int           // 连续失败次数
+	bans        int           // 遇到封禁页面的次数
+	latency     time.Duration // 延迟的指数移动平均
+	lastUsed    time.Time
+	quarantine  time.Duration // 当前的隔离时长，每次探测失败翻倍
+	until       time.Time     // 隔离结束时间，为零值时可用
+}
+
+func (s *proxyState) available() bool {
+	return s.until.IsZero()
+}
+
+// 加权随机选择时的分数
+func (s *proxyState) score() float64 {
+	rate := float64(s.successes+1) / float64(s.successes+s.failures+2)
+	return float64(s.weight) * rate / (1 + s.latency.Seconds())
+}
+
+// 代理的统计信息
+type Stat struct {
+	URL         string
+	Weight      int
+	Successes   int
+	Failures    int
+	Bans        int
+	Latency     time.Duration
+	LastUsed    time.Time
+	Quarantined bool
+}
+
+// Pool 带健康检查的代理池
+// 连续失败 MaxFailures 次或遇到封禁页面的代理会被隔离，隔离结束后通过 ProbeURL 探测，
+// 探测成功才重新使用，失败则加倍隔离时间；Source 不为空时定期重新加载代理列表
+type Pool struct {
+	Strategy       Strategy
+	MaxFailures    int           // 连续失败多少次后隔离
+	Quarantine     time.Duration // 首次隔离时长
+	MaxQuarantine  time.Duration
+	ProbeURL       string // 为空时隔离结束后直接恢复
+	ProbeTimeout   time.Duration
+	ProbeInterval  time.Duration
+	Source         string // 代理列表的文件路径或 http(s) 地址
+	ReloadInterval time.Duration
+	Affinity       Affinity      // 请求与代理的绑定方式，为空时每个请求重新选择
+	StickyTTL      time.Duration // 绑定的有效期，为 0 时不过期
+	Logger         *zap.Logger
+
+	lock    sync.Mutex
+	proxies []*proxyState
+	index   map[string]*proxyState
+	sticky  map[string]*binding
+}
+
+func NewPool() *Pool {
+	return &Pool{
+		Strategy:       Weighted,
+		MaxFailures:    3,
+		Quarantine:     time.Minute,
+		MaxQuarantine:  time.Hour,
+		ProbeTimeout:   10 * time.Second,
+		ProbeInterval:  30 * time.Second,
+		ReloadInterval: 5 * time.Minute,
+		StickyTTL:      10 * time.Minute,
+		Logger:         zap.NewNop(),
+		index:          make(map[string]*proxyState),
+		sticky:         make(map[string]*binding),
+	}
+}
+
+// 替换代理列表，保留仍在列表中的代理的统计信息
+// 每一项为代理地址，后面可以用空格分隔权重，例如 "http://127.0.0.1:7890 3"
+func (p *Pool) Update(entries []string) error {
+	states := make([]*proxyState, 0, len(entries))
+	index := make(map[string]*proxyState, len(entries))
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, e := range entries {
+		u, weight, err := parseEntry(e)
+		if err != nil {
+			return err
+		}
+		key := u.String()
+		if _, ok := index[key]; ok {
+			continue
+		}
+		s, ok := p.index[key]
+		if !ok {
+			s = &proxyState{url: u}
+		}
+		s.weight = weight
+		states = append(states, s)
+		index[key] = s
+	}
+	p.proxies = states
+	p.index = index
+	return nil
+}
+
+func (p *Pool) Len() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return len(p.proxies)
+}
+
+// 选择一个可用的代理
+func (p *Pool) Next() (*url.URL, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	s, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	return s.url, nil
+}
+
+func (p *Pool) next() (*proxyState, error) {
+	var candidates []*proxyState
+	for _, s := range p.proxies {
+		if s.available() {
+			candidates = append(candidates, s)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, ErrNoProxy
+	}
+
+	var chosen *proxyState
+	switch p.Strategy {
+	case LRU:
+		chosen = candidates[0]
+		for _, s := range candidates[1:] {
+			if s.lastUsed.Before(chosen.lastUsed) {
+				chosen = s
+			}
+		}
+	default:
+		total := 0.0
+		for _, s := range candidates {
+			total += s.score()
+		}
+		r := rand.Float64() * total
+		chosen = candidates[len(candidates)-1]
+		for _, s := range candidates {
+			r -= s.score()
+			if r < 0 {
+				chosen = s
+				break
+			}
+		}
+	}
+	chosen.lastUsed = time.Now()
+	return chosen, nil
+}
+
+// 代理是否可用，不在代理池中时返回 false
+func (p *Pool) Available(u *url.URL) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	s, ok := p.index[u.String()]
+	return ok && s.available()
+}
+
+// 记录一次成功的请求
+func (p *Pool) Success(u *url.URL, latency time.Duration) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	s, ok := p.index[u.String()]
+	if !ok {
+		return
+	}
+	s.successes++
+	s.consecutive = 0
+	if s.latency == 0 {
+		s.latency = latency
+	} else {
+		s.latency = (s.latency*4 + latency) / 5
+	}
+}
+
+// 记录一次失败的请求，连续失败过多时隔离
+func (p *Pool) Failure(u *url.URL) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	s, ok := p.index[u.String()]
+	if !ok {
+		return
+	}
+	s.failures++
+	s.consecutive++
+	p.unbind(s)
+	if s.consecutive >= p.MaxFailures {
+		p.quarantine(s, "too many failures")
+	}
+}
+
+// 代理遇到封禁页面，立即隔离
+func (p *Pool) Ban(u *url.URL) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	s, ok := p.index[u.String()]
+	if !ok {
+		return
+	}
+	s.bans++
+	p.unbind(s)
+	p.quarantine(s, "banned")
+}
+
+func (p *Pool) quarantine(s *proxyState, reason string) {
+	if !s.until.IsZero() {
+		return
+	}
+	if s.quarantine == 0 {
+		s.quarantine = p.Quarantine
+	}
+	s.until = time.Now().Add(s.quarantine)
+	p.Logger.Warn("proxy quarantined",
+		zap.String("proxy", s.url.Redacted()),
+		zap.String("reason", reason),
+		zap.Duration("duration", s.quarantine))
+}
+
+// 隔离结束且探测成功的代理重新可用，探测失败时加倍隔离时间
+func (p *Pool) Probe(ctx context.Context) {
+	p.lock.Lock()
+	now := time.Now()
+	var due []*proxyState
+	for _, s := range p.proxies {
+		if !s.until.IsZero() && !s.until.After(now) {
+			due = append(due, s)
+		}
+	}
+	p.lock.Unlock()
+
+	p.expire()
+
+	for _, s := range due {
+		err := p.probe(ctx, s.url)
+		p.lock.Lock()
+		if err == nil {
+			s.until = time.Time{}
+			s.consecutive = 0
+			s.quarantine = 0
+			p.Logger.Info("proxy restored", zap.String("proxy", s.url.Redacted()))
+		} else {
+			s.quarantine *= 2
+			if s.quarantine > p.MaxQuarantine {
+				s.quarantine = p.MaxQuarantine
+			}
+			s.until = time.Now().Add(s.quarantine)
+			p.Logger.Warn("probe proxy failed", zap.String("proxy", s.url.Redacted()), zap.Error(err))
+		}
+		p.lock.Unlock()
+	}
+}
+
+func (p *Pool) probe(ctx context.Context, u *url.URL) error {
+	if p.ProbeURL == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.ProbeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.ProbeURL, nil)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(u)}}
+	defer client.CloseIdleConnections()
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("probe status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// 从 Source 重新加载代理列表
+func (p *Pool) Reload(ctx context.Context) error {
+	entries, err := LoadList(ctx, p.Source)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return errors.New("proxy list is empty")
+	}
+	return p.Update(entries)
+}
+
+// 定期探测被隔离的代理并重新加载代理列表，直到 ctx 取消
+func (p *Pool) Run(ctx context.Context) {
+	probe := time.NewTicker(p.ProbeInterval)
+	defer probe.Stop()
+	var reload <-chan time.Time
+	if p.Source != "" && p.ReloadInterval > 0 {
+		t := time.NewTicker(p.ReloadInterval)
+		defer t.Stop()
+		reload = t.C
+	}
+	for {
+		select {
+		case <-probe.C:
+			p.Probe(ctx)
+		case <-reload:
+			if err := p.Reload(ctx); err != nil {
+				p.Logger.Error("reload proxy list failed", zap.Error(err))
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// 代理的统计信息，按地址排序
+func (p *Pool) Stats() []Stat {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	stats := make([]Stat, 0, len(p.proxies))
+	for _, s := range p.proxies {
+		stats = append(stats, Stat{
+			URL:         s.url.Redacted(),
+			Weight:      s.weight,
+			Successes:   s.successes,
+			Failures:    s.failures,
+			Bans:        s.bans,
+			Latency:     s.latency,
+			LastUsed:    s.lastUsed,
+			Quarantined: !s.until.IsZero(),
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].URL < stats[j].URL })
+	return stats
+}
+
+// 作为 http.Transport 的 Proxy 使用，请求的 context 中指定了代理时使用指定的代理
+func (p *Pool) Func() Func {
+	return func(req *http.Request) (*url.URL, error) {
+		if u, ok := FromContext(req.Context()); ok {
+			return u, nil
+		}
+		return p.Next()
+	}
+}
+
+type ctxKey struct{}
+
+// 在请求的 context 中指定代理
+func WithURL(ctx context.Context, u *url.URL) context.Context {
+	return context.WithValue(ctx, ctxKey{}, u)
+}
+
+func FromContext(ctx context.Context) (*url.URL, bool) {
+	u, ok := ctx.Value(ctxKey{}).(*url.URL)
+	return u, ok
+}
@@ -0,0 +1,157 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"gocrawler/spider"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPool(t *testing.T) {
+	p := NewPool()
+	assert.Nil(t, p.Update([]string{"http://a:1", "b:2 3", "http://a:1"}))
+	assert.Equal(t, 2, p.Len())
+	assert.NotNil(t, p.Update([]string{"http://c:3 x"}))
+
+	// 最久没有使用的代理
+	p.Strategy = LRU
+	u1, _ := p.Next()
+	u2, _ := p.Next()
+	u3, _ := p.Next()
+	assert.NotEqual(t, u1, u2)
+	assert.Equal(t, u1, u3)
+
+	// 连续失败后隔离
+	for i := 0; i < p.MaxFailures; i++ {
+		p.Failure(u1)
+	}
+	assert.False(t, p.Available(u1))
+	for i := 0; i < 3; i++ {
+		u, err := p.Next()
+		assert.Nil(t, err)
+		assert.Equal(t, u2, u)
+	}
+	p.Ban(u2)
+	_, err := p.Next()
+	assert.Equal(t, ErrNoProxy, err)
+
+	// 重新加载后保留统计信息
+	assert.Nil(t, p.Update([]string{"http://a:1", "http://b:2"}))
+	assert.False(t, p.Available(u1))
+	stats := p.Stats()
+	assert.Equal(t, 3, stats[0].Failures)
+	assert.Equal(t, 1, stats[1].Bans)
+
+	// 隔离结束后探测成功，恢复使用
+	p.Quarantine = 0
+	p.lock.Lock()
+	for _, s := range p.proxies {
+		s.until = time.Now()
+	}
+	p.lock.Unlock()
+	p.Probe(context.Background())
+	assert.True(t, p.Available(u1))
+	assert.True(t, p.Available(u2))
+}
+
+func TestProbe(t *testing.T) {
+	// 作为 HTTP 代理，直接返回结果
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer healthy.Close()
+
+	p := NewPool()
+	p.ProbeURL = "http://example.com/"
+	p.Update([]string{healthy.URL, "http://127.0.0.1:1"})
+	p.lock.Lock()
+	for _, s := range p.proxies {
+		s.quarantine = time.Minute
+		s.until = time.Now()
+	}
+	p.lock.Unlock()
+	p.Probe(context.Background())
+	for _, s := range p.Stats() {
+		assert.Equal(t, s.URL != healthy.URL, s.Quarantined, s.URL)
+	}
+}
+
+func TestLoadList(t *testing.T) {
+	list := "# proxies\nhttp://a:1 2\n\nb:2\n"
+	path := filepath.Join(t.TempDir(), "proxies.txt")
+	os.WriteFile(path, []byte(list), 0o644)
+	entries, err := LoadList(context.Background(), path)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"http://a:1 2", "b:2"}, entries)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(list))
+	}))
+	defer server.Close()
+	p := NewPool()
+	p.Source = server.URL
+	assert.Nil(t, p.Reload(context.Background()))
+	assert.Equal(t, 2, p.Len())
+}
+
+func TestMiddleware(t *testing.T) {
+	p := NewPool()
+	p.MaxFailures = 1
+	p.Update([]string{"http://a:1"})
+	fail := true
+	f := p.Middleware()(spider.FetchFunc(func(req *spider.Request) (*spider.Response, error) {
+		assert.Equal(t, "http://a:1", req.Proxy)
+		if fail {
+			return nil, errors.New("connection refused")
+		}
+		return &spider.Response{StatusCode: 200}, nil
+	}))
+
+	fail = false
+	req := &spider.Request{URL: "http://example.com"}
+	_, err := f.Get(req)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, p.Stats()[0].Successes)
+
+	p.OnBan(req, nil)
+	_, err = f.Get(req)
+	assert.Equal(t, ErrNoProxy, err)
+}
+
+func TestSelect(t *testing.T) {
+	p := NewPool()
+	p.Update([]string{"http://a:1", "http://b:2", "http://c:3"})
+	task := &spider.Task{Options: spider.Options{Name: "douban"}}
+
+	p.Affinity = BySession
+	alice := &spider.Request{Task: task, URL: "https://book.douban.com/", Session: "alice"}
+	u, _ := p.Select(alice)
+	for i := 0; i < 5; i++ {
+		got, _ := p.Select(alice)
+		assert.Equal(t, u, got)
+	}
+	assert.Equal(t, "", StickyKey(BySession, &spider.Request{URL: "https://book.douban.com/"}))
+
+	// 绑定的代理失败后重新选择
+	p.Failure(u)
+	p.Strategy = LRU
+	next, _ := p.Select(alice)
+	assert.NotEqual(t, u, next)
+	got, _ := p.Select(alice)
+	assert.Equal(t, next, got)
+
+	// 绑定过期后重新选择
+	p.StickyTTL = time.Nanosecond
+	p.Affinity = ByHost
+	a, _ := p.Select(alice)
+	time.Sleep(time.Millisecond)
+	b, _ := p.Select(&spider.Request{Task: task, URL: "https://book.douban.com/subject/1"})
+	assert.NotEqual(t, a, b)
+
+	assert.Equal(t, "task:douban", StickyKey(ByTask, alice))
+	assert.Equal(t, "host:book.douban.com", StickyKey(ByHost, alice))
+}
@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// 从文件或 http(s) 地址读取代理列表，每行一个代理，忽略空行与 # 开头的注释
+func LoadList(ctx context.Context, source string) ([]string, error) {
+	var r io.Reader
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("load proxy list status %d", resp.StatusCode)
+		}
+		r = resp.Body
+	} else {
+		f, err := os.Open(source)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var entries []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entries = append(entries, line)
+	}
+	return entries, scanner.Err()
+}
+
+// 解析 "地址 [权重]"，没有协议时默认为 http
+func parseEntry(entry string) (*url.URL, int, error) {
+	fields := strings.Fields(entry)
+	if len(fields) == 0 {
+		return nil, 0, fmt.Errorf("empty proxy entry")
+	}
+	raw := fields[0]
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, 0, err
+	}
+	weight := 1
+	if len(fields) > 1 {
+		if weight, err = strconv.Atoi(fields[1]); err != nil || weight <= 0 {
+			return nil, 0, fmt.Errorf("invalid proxy weight:%s", entry)
+		}
+	}
+	return u, weight, nil
+}
@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"gocrawler/spider"
+	"net/url"
+	"time"
+)
+
+type Affinity string
+
+const (
+	BySession Affinity = "session" // 同一个 Cookie 会话使用同一个代理，没有会话时每次重新选择
+	ByHost    Affinity = "host"    // 同一个域名使用同一个代理
+	ByTask    Affinity = "task"    // 同一个任务使用同一个代理
+)
+
+type binding struct {
+	state   *proxyState
+	expires time.Time // 为零值时不过期
+}
+
+// 请求的绑定键，为空时不绑定代理
+func StickyKey(a Affinity, req *spider.Request) string {
+	switch a {
+	case BySession:
+		if req.Session != "" {
+			return "session:" + req.Session
+		}
+	case ByHost:
+		if u, err := url.Parse(req.URL); err == nil && u.Host != "" {
+			return "host:" + u.Hostname()
+		}
+	case ByTask:
+		if req.Task != nil {
+			return "task:" + req.Task.Name
+		}
+	}
+	return ""
+}
+
+// 为请求选择代理，按 Affinity 复用绑定的代理
+// 绑定的代理失败、被隔离或绑定过期时重新选择，并绑定新的代理
+func (p *Pool) Select(req *spider.Request) (*url.URL, error) {
+	key := StickyKey(p.Affinity, req)
+	if key == "" {
+		return p.Next()
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	now := time.Now()
+	if b, ok := p.sticky[key]; ok {
+		if (b.expires.IsZero() || now.Before(b.expires)) && b.state.available() && p.index[b.state.url.String()] == b.state {
+			b.state.lastUsed = now
+			return b.state.url, nil
+		}
+		delete(p.sticky, key)
+	}
+	s, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	b := &binding{state: s}
+	if p.StickyTTL > 0 {
+		b.expires = now.Add(p.StickyTTL)
+	}
+	p.sticky[key] = b
+	return s.url, nil
+}
+
+// 解除代理的所有绑定，需要持有锁
+func (p *Pool) unbind(s *proxyState) {
+	for key, b := range p.sticky {
+		if b.state == s {
+			delete(p.sticky, key)
+		}
+	}
+}
+
+// 清理过期的绑定
+func (p *Pool) expire() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	now := time.Now()
+	for key, b := range p.sticky {
+		if !b.expires.IsZero() && now.After(b.expires) {
+			delete(p.sticky, key)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package revisit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+type record struct {
+	Key string `json:"key"`
+	Meta
+}
+
+// File 基于本地追加日志的抓取记录
+// 每次更新追加一行 JSON，启动时回放日志，同一个 key 以最后一行为准；
+// 日志中的过期记录超过一半时，启动时会重写日志
+type File struct {
+	mem  *Memory
+	path string
+	f    *os.File
+	w    *bufio.Writer
+	lock sync.Mutex
+}
+
+func NewFile(path string) (*File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	s := &File{
+		mem:  NewMemory(),
+		path: path,
+	}
+	lines, err := s.load()
+	if err != nil {
+		return nil, fmt.Errorf("load revisit log failed:%w", err)
+	}
+	if lines > 2*len(s.mem.metas) {
+		if err := s.compact(); err != nil {
+			return nil, fmt.Errorf("compact revisit log failed:%w", err)
+		}
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	s.f = f
+	s.w = bufio.NewWriter(f)
+	return s, nil
+}
+
+// 回放日志，返回日志行数
+func (s *File) load() (int, error) {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	lines := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			// 忽略异常退出时写入的不完整记录
+			continue
+		}
+		lines++
+		s.mem.metas[r.Key] = r.Meta
+	}
+	return lines, scanner.Err()
+}
+
+// 只保留每个 key 的最新记录
+func (s *File) compact() error {
+	tmp := s.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for key, meta := range s.mem.metas {
+		if err := enc.Encode(record{Key: key, Meta: meta}); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func (s *File) Get(key string) (Meta, bool) {
+	return s.mem.Get(key)
+}
+
+func (s *File) Put(key string, meta Meta) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	data, err := json.Marshal(record{Key: key, Meta: meta})
+	if err != nil {
+		return err
+	}
+	if _, err := s.w.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	return s.mem.Put(key, meta)
+}
+
+func (s *File) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	return s.f.Close()
+}
@@ -0,0 +1,50 @@
+package revisit
+
+import (
+	"sync"
+	"time"
+)
+
+// 上一次抓取时服务端返回的缓存校验信息
+type Meta struct {
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	Fetched      time.Time `json:"fetched"` // 上一次抓取完成的时间
+}
+
+// Store 按 Request.Unique() 保存请求的抓取记录，用于增量抓取
+type Store interface {
+	Get(key string) (Meta, bool)
+	Put(key string, m Meta) error
+	Close() error
+}
+
+// Memory 基于内存的抓取记录，进程重启后数据丢失
+type Memory struct {
+	metas map[string]Meta
+	lock  sync.RWMutex
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		metas: make(map[string]Meta),
+	}
+}
+
+func (m *Memory) Get(key string) (Meta, bool) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	meta, ok := m.metas[key]
+	return meta, ok
+}
+
+func (m *Memory) Put(key string, meta Meta) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.metas[key] = meta
+	return nil
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
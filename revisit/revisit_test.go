@@ -0,0 +1,43 @@
+package revisit
+
+import (
+	"bufio"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "revisit.log")
+	s, err := NewFile(path)
+	assert.Nil(t, err)
+	now := time.Now().Truncate(time.Second)
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, s.Put("a", Meta{ETag: "v1", Fetched: now}))
+	}
+	assert.Nil(t, s.Put("a", Meta{ETag: "v2", LastModified: "Mon, 02 Jan 2006 15:04:05 GMT", Fetched: now}))
+	assert.Nil(t, s.Close())
+
+	s, err = NewFile(path)
+	assert.Nil(t, err)
+	defer s.Close()
+	m, ok := s.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, "v2", m.ETag)
+	assert.True(t, now.Equal(m.Fetched))
+	_, ok = s.Get("b")
+	assert.False(t, ok)
+
+	// 重复的记录在启动时被压缩
+	f, err := os.Open(path)
+	assert.Nil(t, err)
+	defer f.Close()
+	lines := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines++
+	}
+	assert.Equal(t, 1, lines)
+}
@@ -0,0 +1,161 @@
+package robots
+
+import (
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	"gocrawler/spider"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// 获取失败时缓存的时间，避免频繁请求
+const errTTL = 10 * time.Second
+
+// 获取 robots.txt 的超时时间，不受调用方 ctx 的影响
+const fetchTimeout = 30 * time.Second
+
+// robots.txt 最大读取的字节数
+const maxSize = 512 * 1024
+
+// Checker 按域名获取并缓存 robots.txt，判断请求是否允许抓取
+// Crawl-delay 通过 CrawlDelay 按域名提供给 PoliteSchedule
+type Checker struct {
+	UserAgent string
+	TTL       time.Duration
+	Client    *http.Client
+	Logger    *zap.Logger
+	cache     map[string]*entry
+	lock      sync.Mutex
+}
+
+type entry struct {
+	robots  *Robots
+	err     error // 暂时无法获取 robots.txt
+	expires time.Time
+	ready   chan struct{}
+}
+
+func NewChecker(userAgent string, ttl time.Duration) *Checker {
+	return &Checker{
+		UserAgent: userAgent,
+		TTL:       ttl,
+		Client:    &http.Client{Timeout: 10 * time.Second},
+		Logger:    zap.NewNop(),
+		cache:     make(map[string]*entry),
+	}
+}
+
+// 返回 rawurl 所在域名的 Crawl-delay，robots.txt 尚未获取时返回 0
+func (c *Checker) CrawlDelay(rawurl string) time.Duration {
+	u, err := url.Parse(rawurl)
+	if err != nil || u.Host == "" {
+		return 0
+	}
+	c.lock.Lock()
+	e, ok := c.cache[u.Scheme+"://"+u.Host]
+	c.lock.Unlock()
+	if !ok {
+		return 0
+	}
+	select {
+	case <-e.ready:
+	default:
+		return 0
+	}
+	if e.robots == nil {
+		return 0
+	}
+	if g := e.robots.Group(c.UserAgent); g != nil {
+		return g.CrawlDelay
+	}
+	return 0
+}
+
+// 判断 rawurl 是否允许抓取
+// 网络错误或服务端错误时返回 spider.ErrRobotsUnavailable，ctx 取消时返回 ctx.Err()
+func (c *Checker) Allowed(ctx context.Context, rawurl string) (bool, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil || u.Host == "" {
+		return true, nil
+	}
+	r, err := c.get(ctx, u)
+	if err != nil {
+		return false, err
+	}
+	return r.Allowed(c.UserAgent, rawurl), nil
+}
+
+func (c *Checker) get(ctx context.Context, u *url.URL) (*Robots, error) {
+	key := u.Scheme + "://" + u.Host
+
+	c.lock.Lock()
+	e, ok := c.cache[key]
+	if ok {
+		select {
+		case <-e.ready:
+			if time.Now().After(e.expires) {
+				ok = false
+			}
+		default:
+		}
+	}
+	if !ok {
+		// 同一域名只有一个请求去获取 robots.txt，其他请求等待结果
+		e = &entry{ready: make(chan struct{})}
+		c.cache[key] = e
+		c.lock.Unlock()
+		// 结果由所有等待的请求共用，不能因为第一个请求的 ctx 取消而失败
+		go func() {
+			fctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), fetchTimeout)
+			defer cancel()
+			e.robots, e.expires, e.err = c.fetch(fctx, key)
+			close(e.ready)
+		}()
+	} else {
+		c.lock.Unlock()
+	}
+
+	select {
+	case <-e.ready:
+		return e.robots, e.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// 暂时无法获取时返回错误，请求按重试策略处理
+func (c *Checker) fetch(ctx context.Context, site string) (*Robots, time.Time, error) {
+	now := time.Now()
+	req, err := http.NewRequestWithContext(ctx, "GET", site+"/robots.txt", nil)
+	if err != nil {
+		return AllowAll, now.Add(c.TTL), nil
+	}
+	req.Header.Set("User-Agent", c.UserAgent)
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		c.Logger.Warn("fetch robots.txt failed", zap.String("site", site), zap.Error(err))
+		return nil, now.Add(errTTL), fmt.Errorf("%w:%s:%v", spider.ErrRobotsUnavailable, site, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 500:
+		c.Logger.Warn("fetch robots.txt failed", zap.String("site", site), zap.Int("status", resp.StatusCode))
+		return nil, now.Add(errTTL), fmt.Errorf("%w:%s:status %d", spider.ErrRobotsUnavailable, site, resp.StatusCode)
+	case resp.StatusCode >= 400:
+		// robots.txt 不存在，允许抓取所有路径
+		return AllowAll, now.Add(c.TTL), nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSize))
+	if err != nil {
+		c.Logger.Warn("read robots.txt failed", zap.String("site", site), zap.Error(err))
+		return nil, now.Add(errTTL), fmt.Errorf("%w:%s:%v", spider.ErrRobotsUnavailable, site, err)
+	}
+	return Parse(data), now.Add(c.TTL), nil
+}
@@ -0,0 +1,165 @@
+package robots
+
+import (
+	"bufio"
+	"bytes"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 解析后的 robots.txt
+type Robots struct {
+	groups []*Group
+}
+
+// 针对一组 User-agent 的规则
+type Group struct {
+	agents     []string
+	rules      []rule
+	CrawlDelay time.Duration
+}
+
+type rule struct {
+	allow bool
+	path  string
+}
+
+// 允许访问所有路径的规则，robots.txt 不存在时使用
+var AllowAll = &Robots{}
+
+func Parse(data []byte) *Robots {
+	r := &Robots{}
+	var group *Group
+	// 连续的 User-agent 属于同一组
+	inAgents := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if !inAgents {
+				group = &Group{}
+				r.groups = append(r.groups, group)
+				inAgents = true
+			}
+			group.agents = append(group.agents, strings.ToLower(value))
+		case "allow", "disallow":
+			inAgents = false
+			if group == nil {
+				continue
+			}
+			// 空的 Disallow 表示允许访问所有路径
+			if value == "" {
+				continue
+			}
+			group.rules = append(group.rules, rule{allow: key == "allow", path: value})
+		case "crawl-delay":
+			inAgents = false
+			if group == nil {
+				continue
+			}
+			if d, err := strconv.ParseFloat(value, 64); err == nil && d > 0 {
+				group.CrawlDelay = time.Duration(d * float64(time.Second))
+			}
+		default:
+			inAgents = false
+		}
+	}
+	return r
+}
+
+// 返回与 agent 匹配的规则组，优先匹配最长的 User-agent，其次匹配 *
+func (r *Robots) Group(agent string) *Group {
+	agent = strings.ToLower(agent)
+	var match, wildcard *Group
+	longest := 0
+	for _, g := range r.groups {
+		for _, a := range g.agents {
+			if a == "*" {
+				if wildcard == nil {
+					wildcard = g
+				}
+				continue
+			}
+			if strings.Contains(agent, a) && len(a) > longest {
+				match, longest = g, len(a)
+			}
+		}
+	}
+	if match != nil {
+		return match
+	}
+	return wildcard
+}
+
+// 判断 agent 是否可以访问 rawurl
+func (r *Robots) Allowed(agent string, rawurl string) bool {
+	g := r.Group(agent)
+	if g == nil {
+		return true
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return true
+	}
+	return g.Allowed(u.RequestURI())
+}
+
+// 按最长匹配规则判断路径是否可以访问，长度相同时 Allow 优先
+func (g *Group) Allowed(path string) bool {
+	if path == "/robots.txt" {
+		return true
+	}
+	allowed := true
+	longest := -1
+	for _, rl := range g.rules {
+		if !match(rl.path, path) {
+			continue
+		}
+		if len(rl.path) > longest || (len(rl.path) == longest && rl.allow) {
+			allowed, longest = rl.allow, len(rl.path)
+		}
+	}
+	return allowed
+}
+
+// 支持 * 通配符与表示结尾的 $
+func match(pattern, path string) bool {
+	end := strings.HasSuffix(pattern, "$")
+	if end {
+		pattern = strings.TrimSuffix(pattern, "$")
+	}
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	rest := path[len(parts[0]):]
+	for _, part := range parts[1:] {
+		i := strings.Index(rest, part)
+		if i < 0 {
+			return false
+		}
+		rest = rest[i+len(part):]
+	}
+	if end {
+		// 最后一段需要匹配到结尾
+		if len(parts) > 1 {
+			return strings.HasSuffix(path, parts[len(parts)-1])
+		}
+		return rest == ""
+	}
+	return true
+}
@@ -0,0 +1,103 @@
+package robots
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"gocrawler/spider"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const content = `
+# comment
+User-agent: *
+Disallow: /private/
+Allow: /private/public
+Disallow: /*.pdf$
+
+User-agent: BadBot
+User-agent: gocrawler
+Disallow: /search
+Crawl-delay: 2
+`
+
+func TestRobots_Allowed(t *testing.T) {
+	r := Parse([]byte(content))
+
+	tests := []struct {
+		agent string
+		url   string
+		want  bool
+	}{
+		{"Mozilla", "http://a.com/", true},
+		{"Mozilla", "http://a.com/private/secret", false},
+		{"Mozilla", "http://a.com/private/public/page", true},
+		{"Mozilla", "http://a.com/doc/a.pdf", false},
+		{"Mozilla", "http://a.com/doc/a.pdf?x=1", true},
+		{"gocrawler/1.0", "http://a.com/search?q=go", false},
+		{"gocrawler/1.0", "http://a.com/private/secret", true},
+		{"robots", "http://a.com/robots.txt", true},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, r.Allowed(tt.agent, tt.url), tt.agent+" "+tt.url)
+	}
+	assert.Equal(t, 2*time.Second, r.Group("gocrawler").CrawlDelay)
+	assert.True(t, AllowAll.Allowed("gocrawler", "http://a.com/any"))
+}
+
+func TestChecker(t *testing.T) {
+	var hits int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Write([]byte(content))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c := NewChecker("gocrawler", time.Hour)
+	ctx := context.Background()
+	assertAllowed(t, c, ctx, server.URL+"/book", true)
+	assertAllowed(t, c, ctx, server.URL+"/search", false)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+	assert.Equal(t, 2*time.Second, c.CrawlDelay(server.URL+"/book"))
+
+	// robots.txt 不存在时允许抓取
+	missing := httptest.NewServer(http.NotFoundHandler())
+	defer missing.Close()
+	assertAllowed(t, c, ctx, missing.URL+"/search", true)
+	// Crawl-delay 只作用于声明它的域名
+	assert.Zero(t, c.CrawlDelay(missing.URL+"/search"))
+
+	// 服务端错误时返回可以重试的错误，而不是禁止抓取
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer broken.Close()
+	_, err := c.Allowed(ctx, broken.URL+"/book")
+	assert.ErrorIs(t, err, spider.ErrRobotsUnavailable)
+	assert.False(t, errors.Is(err, spider.ErrDisallowed))
+
+	// 第一个请求的 ctx 取消不影响其他等待的请求
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte(content))
+	}))
+	defer slow.Close()
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = c.Allowed(cctx, slow.URL+"/book")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assertAllowed(t, c, ctx, slow.URL+"/book", true)
+	assertAllowed(t, c, ctx, slow.URL+"/search", false)
+}
+
+func assertAllowed(t *testing.T, c *Checker, ctx context.Context, url string, want bool) {
+	allowed, err := c.Allowed(ctx, url)
+	assert.Nil(t, err, url)
+	assert.Equal(t, want, allowed, url)
+}
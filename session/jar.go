@@ -0,0 +1,128 @@
+package session
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// 可持久化的 Cookie
+type Cookie struct {
+	Name     string    `json:"name"`
+	Value    string    `json:"value"`
+	Domain   string    `json:"domain"`
+	Path     string    `json:"path"`
+	Expires  time.Time `json:"expires,omitempty"` // 为零值时表示会话 Cookie
+	Secure   bool      `json:"secure,omitempty"`
+	HostOnly bool      `json:"host_only,omitempty"` // 只发送给完全相同的域名
+}
+
+func (c *Cookie) expired(now time.Time) bool {
+	return !c.Expires.IsZero() && !c.Expires.After(now)
+}
+
+func (c *Cookie) match(u *url.URL) bool {
+	host := strings.ToLower(u.Hostname())
+	if c.HostOnly {
+		if host != c.Domain {
+			return false
+		}
+	} else if host != c.Domain && !strings.HasSuffix(host, "."+c.Domain) {
+		return false
+	}
+	if c.Secure && u.Scheme != "https" {
+		return false
+	}
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+	return strings.HasPrefix(path, c.Path)
+}
+
+// 合并服务端设置的 Cookie，返回是否有变化
+func setCookies(jar []*Cookie, u *url.URL, cookies []*http.Cookie) ([]*Cookie, bool) {
+	now := time.Now()
+	changed := false
+	for _, hc := range cookies {
+		c := &Cookie{
+			Name:   hc.Name,
+			Value:  hc.Value,
+			Domain: strings.TrimPrefix(strings.ToLower(hc.Domain), "."),
+			Path:   hc.Path,
+			Secure: hc.Secure,
+		}
+		if c.Domain == "" {
+			c.Domain = strings.ToLower(u.Hostname())
+			c.HostOnly = true
+		}
+		if c.Path == "" || c.Path[0] != '/' {
+			c.Path = "/"
+		}
+		switch {
+		case hc.MaxAge < 0:
+			c.Expires = now
+		case hc.MaxAge > 0:
+			c.Expires = now.Add(time.Duration(hc.MaxAge) * time.Second)
+		case !hc.Expires.IsZero():
+			c.Expires = hc.Expires
+		}
+
+		replaced := false
+		for i, old := range jar {
+			if old.Name != c.Name || old.Domain != c.Domain || old.Path != c.Path {
+				continue
+			}
+			replaced = true
+			if *old != *c {
+				jar[i] = c
+				changed = true
+			}
+			break
+		}
+		if !replaced {
+			jar = append(jar, c)
+			changed = true
+		}
+	}
+
+	// 清理过期的 Cookie
+	live := jar[:0]
+	for _, c := range jar {
+		if c.expired(now) {
+			changed = true
+			continue
+		}
+		live = append(live, c)
+	}
+	return live, changed
+}
+
+// 返回需要发送给 u 的 Cookie
+func cookiesFor(jar []*Cookie, u *url.URL) []*http.Cookie {
+	now := time.Now()
+	var cookies []*http.Cookie
+	for _, c := range jar {
+		if c.expired(now) || !c.match(u) {
+			continue
+		}
+		cookies = append(cookies, &http.Cookie{Name: c.Name, Value: c.Value})
+	}
+	return cookies
+}
+
+// 解析浏览器中复制的 Cookie 字符串，例如 "a=1; b=2"
+func parseCookieString(s string, domain string) []*Cookie {
+	r := http.Request{Header: http.Header{"Cookie": []string{s}}}
+	var jar []*Cookie
+	for _, hc := range r.Cookies() {
+		jar = append(jar, &Cookie{
+			Name:   hc.Name,
+			Value:  hc.Value,
+			Domain: strings.TrimPrefix(strings.ToLower(domain), "."),
+			Path:   "/",
+		})
+	}
+	return jar
+}
@@ -0,0 +1,242 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"gocrawler/spider"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 所有会话都在冷却中
+var ErrNoSession = errors.New("no available session")
+
+// 一个会话对应一个账号的 Cookie
+type Session struct {
+	ID          string    `json:"id"`
+	Cookies     []*Cookie `json:"cookies"`
+	BannedUntil time.Time `json:"banned_until,omitempty"` // 被封禁后在此之前不再使用
+	Bans        int       `json:"bans"`                   // 被封禁的次数
+}
+
+func (s *Session) available(now time.Time) bool {
+	return !s.BannedUntil.After(now)
+}
+
+// Pool 一个任务的会话池
+// 请求按轮询分配会话，服务端设置的 Cookie 会合并回该会话；
+// 会话遇到封禁页面后冷却一段时间，期间的请求改用其他会话。
+// path 不为空时，每次变化都会写入文件，重启后恢复
+type Pool struct {
+	Cooldown time.Duration // 被封禁后的冷却时间
+	Logger   *zap.Logger
+
+	path     string
+	sessions []*Session
+	index    map[string]*Session
+	next     int
+	lock     sync.Mutex
+}
+
+// 打开会话池，path 为空时只保存在内存中
+func Open(path string) (*Pool, error) {
+	p := &Pool{
+		Cooldown: 10 * time.Minute,
+		Logger:   zap.NewNop(),
+		path:     path,
+		index:    make(map[string]*Session),
+	}
+	if path == "" {
+		return p, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var sessions []*Session
+	if err := json.Unmarshal(data, &sessions); err != nil {
+		return nil, fmt.Errorf("load sessions failed:%w", err)
+	}
+	for _, s := range sessions {
+		p.add(s)
+	}
+	return p, nil
+}
+
+func (p *Pool) add(s *Session) {
+	p.sessions = append(p.sessions, s)
+	p.index[s.ID] = s
+}
+
+// 添加账号，cookie 为浏览器中复制的 Cookie 字符串，作用于 domain 及其子域名
+// 已经存在的会话不会被覆盖，以保留上次运行时服务端更新的 Cookie
+func (p *Pool) Add(id string, cookie string, domain string) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if _, ok := p.index[id]; ok {
+		return nil
+	}
+	p.add(&Session{ID: id, Cookies: parseCookieString(cookie, domain)})
+	return p.save()
+}
+
+// 会话 id 的快照
+func (p *Pool) Get(id string) (Session, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	s, ok := p.index[id]
+	if !ok {
+		return Session{}, false
+	}
+	return *s, true
+}
+
+func (p *Pool) Len() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return len(p.sessions)
+}
+
+// 为请求分配会话
+// 指定了不存在的会话时新建一个空会话，用于登录请求写入 Cookie；
+// 指定的会话在冷却中时改用其他会话
+func (p *Pool) pick(id string) (*Session, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	now := time.Now()
+	if id != "" {
+		s, ok := p.index[id]
+		if !ok {
+			s = &Session{ID: id}
+			p.add(s)
+			return s, nil
+		}
+		if s.available(now) {
+			return s, nil
+		}
+	}
+	for i := 0; i < len(p.sessions); i++ {
+		s := p.sessions[(p.next+i)%len(p.sessions)]
+		if s.available(now) {
+			p.next = (p.next + i + 1) % len(p.sessions)
+			return s, nil
+		}
+	}
+	return nil, ErrNoSession
+}
+
+// 返回会话中需要发送给 u 的 Cookie
+func (p *Pool) Cookies(id string, u *url.URL) []*http.Cookie {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	s, ok := p.index[id]
+	if !ok {
+		return nil
+	}
+	return cookiesFor(s.Cookies, u)
+}
+
+// 合并服务端设置的 Cookie
+func (p *Pool) SetCookies(id string, u *url.URL, cookies []*http.Cookie) error {
+	if len(cookies) == 0 {
+		return nil
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	s, ok := p.index[id]
+	if !ok {
+		s = &Session{ID: id}
+		p.add(s)
+	}
+	var changed bool
+	s.Cookies, changed = setCookies(s.Cookies, u, cookies)
+	if !changed {
+		return nil
+	}
+	return p.save()
+}
+
+// 将会话标记为被封禁，冷却结束前不再分配
+func (p *Pool) Ban(id string) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	s, ok := p.index[id]
+	if !ok {
+		return nil
+	}
+	s.Bans++
+	s.BannedUntil = time.Now().Add(p.Cooldown)
+	return p.save()
+}
+
+// 可以作为任务的 BanFunc 使用
+func (p *Pool) OnBan(req *spider.Request, resp *spider.Response) {
+	if req.Session == "" {
+		return
+	}
+	p.Logger.Warn("session banned", zap.String("session", req.Session), zap.String("url", req.URL))
+	if err := p.Ban(req.Session); err != nil {
+		p.Logger.Error("save session failed", zap.Error(err))
+	}
+}
+
+// 先写临时文件再重命名，避免异常退出时文件损坏
+func (p *Pool) save() error {
+	if p.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(p.sessions, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p.path), 0o755); err != nil {
+		return err
+	}
+	tmp := p.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p.path)
+}
+
+// 为请求附加会话的 Cookie，并将响应中的 Set-Cookie 合并回会话
+func (p *Pool) Middleware() spider.Middleware {
+	return func(next spider.Fetcher) spider.Fetcher {
+		return spider.FetchFunc(func(req *spider.Request) (*spider.Response, error) {
+			s, err := p.pick(req.Session)
+			if err != nil {
+				return nil, err
+			}
+			// 记录在原请求上，重试和封禁处理时使用同一个会话
+			req.Session = s.ID
+
+			u, err := url.Parse(req.FullURL())
+			if err != nil {
+				return nil, err
+			}
+			// 传递原请求，内层中间件记录的代理对引擎可见，返回后恢复请求自身的 Cookie
+			cookies := req.Cookies
+			req.Cookies = append(p.Cookies(s.ID, u), cookies...)
+			resp, err := next.Get(req)
+			req.Cookies = cookies
+			if resp != nil {
+				if ru, perr := url.Parse(resp.URL); perr == nil {
+					header := http.Response{Header: resp.Header}
+					if serr := p.SetCookies(s.ID, ru, header.Cookies()); serr != nil {
+						p.Logger.Error("save session failed", zap.String("session", s.ID), zap.Error(serr))
+					}
+				}
+			}
+			return resp, err
+		})
+	}
+}
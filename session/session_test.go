@@ -0,0 +1,118 @@
+package session
+
+import (
+	"github.com/stretchr/testify/assert"
+	"gocrawler/spider"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSetCookies(t *testing.T) {
+	u, _ := url.Parse("https://book.douban.com/tag/")
+	jar, changed := setCookies(nil, u, []*http.Cookie{
+		{Name: "bid", Value: "1", Domain: ".douban.com"},
+		{Name: "ck", Value: "a"},
+	})
+	assert.True(t, changed)
+	assert.Len(t, jar, 2)
+
+	_, changed = setCookies(jar, u, []*http.Cookie{{Name: "bid", Value: "1", Domain: ".douban.com"}})
+	assert.False(t, changed)
+
+	jar, changed = setCookies(jar, u, []*http.Cookie{{Name: "ck", Value: "", MaxAge: -1}})
+	assert.True(t, changed)
+	assert.Len(t, jar, 1)
+
+	other, _ := url.Parse("https://www.douban.com/")
+	assert.Len(t, cookiesFor(jar, other), 1)
+	foo, _ := url.Parse("https://foo.com/")
+	assert.Len(t, cookiesFor(jar, foo), 0)
+	assert.Len(t, cookiesFor(parseCookieString("a=1; b=2", "douban.com"), other), 2)
+}
+
+func TestPool(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.json")
+	p, err := Open(path)
+	assert.Nil(t, err)
+	assert.Nil(t, p.Add("a", "k=a", "example.com"))
+	assert.Nil(t, p.Add("b", "k=b", "example.com"))
+
+	// 轮询分配
+	s1, _ := p.pick("")
+	s2, _ := p.pick("")
+	assert.NotEqual(t, s1.ID, s2.ID)
+
+	// 被封禁的会话不再分配
+	p.OnBan(&spider.Request{Session: "a"}, nil)
+	for i := 0; i < 3; i++ {
+		s, err := p.pick("")
+		assert.Nil(t, err)
+		assert.Equal(t, "b", s.ID)
+	}
+	s, _ := p.pick("a")
+	assert.Equal(t, "b", s.ID)
+	p.Ban("b")
+	_, err = p.pick("")
+	assert.Equal(t, ErrNoSession, err)
+
+	// 重启后恢复
+	p2, err := Open(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, p2.Len())
+	a, ok := p2.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, a.Bans)
+	assert.True(t, a.BannedUntil.After(time.Now()))
+	assert.Nil(t, p2.Add("a", "k=new", "example.com"))
+	a, _ = p2.Get("a")
+	assert.Equal(t, "a", a.Cookies[0].Value)
+}
+
+func TestMiddleware(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "token", Value: "secret", Path: "/"})
+			return
+		}
+		c, err := r.Cookie("token")
+		if err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(c.Value))
+	}))
+	defer server.Close()
+
+	p, _ := Open("")
+	f := spider.Chain(spider.FetchFunc(func(req *spider.Request) (*spider.Response, error) {
+		hreq, err := req.HTTPRequest()
+		if err != nil {
+			return nil, err
+		}
+		resp, err := http.DefaultClient.Do(hreq)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		body := make([]byte, 64)
+		n, _ := resp.Body.Read(body)
+		return &spider.Response{StatusCode: resp.StatusCode, Header: resp.Header, URL: req.URL, Body: body[:n]}, nil
+	}), p.Middleware())
+
+	// 登录请求写入会话
+	login := &spider.Request{URL: server.URL + "/login", Method: "GET", Session: "alice"}
+	_, err := f.Get(login)
+	assert.Nil(t, err)
+
+	req := &spider.Request{URL: server.URL + "/page", Method: "GET"}
+	resp, err := f.Get(req)
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", req.Session)
+	assert.Equal(t, "secret", string(resp.Body))
+	// 会话的 Cookie 不会留在请求上
+	assert.Empty(t, req.Cookies)
+}
@@ -0,0 +1,66 @@
+package sitemap
+
+import (
+	"net/http"
+	"regexp"
+	"time"
+)
+
+type options struct {
+	Pattern     *regexp.Regexp // 只保留匹配的 URL
+	Since       time.Time      // 只保留 lastmod 不早于该时间的条目
+	Priority    int64
+	MaxSitemaps int // 最多读取的 sitemap 文件数量，防止循环引用
+	Timeout     time.Duration
+	Client      *http.Client
+	err         error
+}
+
+var defaultOptions = options{
+	MaxSitemaps: 1000,
+	Timeout:     5 * time.Minute,
+	Client:      &http.Client{Timeout: time.Minute},
+}
+
+type Option func(opts *options)
+
+// URL 过滤规则为正则表达式，编译失败时 Root 返回错误
+func WithPattern(pattern string) Option {
+	return func(opts *options) {
+		if pattern == "" {
+			opts.Pattern = nil
+			return
+		}
+		opts.Pattern, opts.err = regexp.Compile(pattern)
+	}
+}
+
+func WithSince(since time.Time) Option {
+	return func(opts *options) {
+		opts.Since = since
+	}
+}
+
+func WithPriority(priority int64) Option {
+	return func(opts *options) {
+		opts.Priority = priority
+	}
+}
+
+func WithMaxSitemaps(n int) Option {
+	return func(opts *options) {
+		opts.MaxSitemaps = n
+	}
+}
+
+func WithTimeout(timeout time.Duration) Option {
+	return func(opts *options) {
+		opts.Timeout = timeout
+	}
+}
+
+func WithClient(client *http.Client) Option {
+	return func(opts *options) {
+		opts.Client = client
+	}
+}
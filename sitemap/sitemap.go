@@ -0,0 +1,199 @@
+package sitemap
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"gocrawler/spider"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// 单个 sitemap 文件解压后的最大字节数
+const maxSize = 50 * 1024 * 1024
+
+// Generator 读取 sitemap 或 sitemap index，生成指向指定规则的种子请求
+// 可以直接作为 spider.RuleTree 的 Root 使用：
+//
+//	Root: sitemap.New("https://example.com/sitemap.xml", "详情页").Root
+type Generator struct {
+	URL      string
+	RuleName string
+	options
+}
+
+func New(url string, ruleName string, opts ...Option) *Generator {
+	options := defaultOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return &Generator{
+		URL:      url,
+		RuleName: ruleName,
+		options:  options,
+	}
+}
+
+// 实现 spider.RuleTree 的 Root
+func (g *Generator) Root() ([]*spider.Request, error) {
+	ctx := context.Background()
+	if g.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.Timeout)
+		defer cancel()
+	}
+	return g.Requests(ctx)
+}
+
+// 广度优先遍历 sitemap index 及其包含的 sitemap
+func (g *Generator) Requests(ctx context.Context) ([]*spider.Request, error) {
+	if g.err != nil {
+		return nil, g.err
+	}
+	var reqs []*spider.Request
+	visited := map[string]bool{g.URL: true}
+	queue := []string{g.URL}
+	for len(queue) > 0 {
+		if len(visited) > g.MaxSitemaps {
+			return nil, fmt.Errorf("too many sitemaps, max:%d", g.MaxSitemaps)
+		}
+		u := queue[0]
+		queue = queue[1:]
+
+		s, err := g.fetch(ctx, u)
+		if err != nil {
+			return nil, fmt.Errorf("fetch sitemap %s failed:%w", u, err)
+		}
+		for _, e := range s.Sitemaps {
+			if e.Loc == "" || visited[e.Loc] || !g.fresh(e) {
+				continue
+			}
+			visited[e.Loc] = true
+			queue = append(queue, e.Loc)
+		}
+		for _, e := range s.URLs {
+			if e.Loc == "" || !g.fresh(e) {
+				continue
+			}
+			if g.Pattern != nil && !g.Pattern.MatchString(e.Loc) {
+				continue
+			}
+			reqs = append(reqs, &spider.Request{
+				URL:      e.Loc,
+				Method:   "GET",
+				RuleName: g.RuleName,
+				Priority: g.Priority,
+			})
+		}
+	}
+	return reqs, nil
+}
+
+// 没有 lastmod 的条目视为需要抓取
+func (g *Generator) fresh(e entry) bool {
+	if g.Since.IsZero() || e.LastMod == "" {
+		return true
+	}
+	t, err := parseTime(e.LastMod)
+	if err != nil {
+		return true
+	}
+	return !t.Before(g.Since)
+}
+
+type entry struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+// 同时兼容 urlset 与 sitemapindex
+type document struct {
+	URLs     []entry `xml:"url"`
+	Sitemaps []entry `xml:"sitemap"`
+}
+
+func (g *Generator) fetch(ctx context.Context, url string) (*document, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := g.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &spider.StatusError{Code: resp.StatusCode}
+	}
+
+	r := bufio.NewReader(resp.Body)
+	// .xml.gz 文件以原始 gzip 格式返回，根据文件头判断是否需要解压
+	if magic, _ := r.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		r = bufio.NewReader(gr)
+	}
+	return parse(io.LimitReader(r, maxSize))
+}
+
+func parse(r io.Reader) (*document, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return &document{}, nil
+	}
+
+	// 纯文本格式的 sitemap，每行一个 URL
+	if data[0] != '<' {
+		doc := &document{}
+		for _, line := range strings.Split(string(data), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				doc.URLs = append(doc.URLs, entry{Loc: line})
+			}
+		}
+		return doc, nil
+	}
+
+	doc := &document{}
+	if err := xml.Unmarshal(data, doc); err != nil {
+		return nil, err
+	}
+	for i := range doc.URLs {
+		doc.URLs[i].Loc = strings.TrimSpace(doc.URLs[i].Loc)
+	}
+	for i := range doc.Sitemaps {
+		doc.Sitemaps[i].Loc = strings.TrimSpace(doc.Sitemaps[i].Loc)
+	}
+	return doc, nil
+}
+
+// lastmod 使用 W3C Datetime 格式
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+func parseTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid lastmod:%s", s)
+}
@@ -0,0 +1,74 @@
+package sitemap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGenerator(t *testing.T) {
+	var server *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sitemap_index.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>` + server.URL + `/books.xml.gz</loc><lastmod>2023-05-01</lastmod></sitemap>
+  <sitemap><loc>` + server.URL + `/old.xml</loc><lastmod>2020-01-01</lastmod></sitemap>
+  <sitemap><loc>` + server.URL + `/sitemap_index.xml</loc></sitemap>
+</sitemapindex>`))
+	})
+	mux.HandleFunc("/books.xml.gz", func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		gw.Write([]byte(`<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>https://book.example.com/subject/1/</loc><lastmod>2023-04-01T10:00:00+08:00</lastmod></url>
+  <url><loc>https://book.example.com/subject/2/</loc><lastmod>2021-04-01</lastmod></url>
+  <url><loc>https://book.example.com/subject/3/</loc></url>
+  <url><loc>https://book.example.com/tag/novel</loc></url>
+</urlset>`))
+		gw.Close()
+		w.Write(buf.Bytes())
+	})
+	mux.HandleFunc("/old.xml", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("old sitemap should be skipped")
+	})
+	server = httptest.NewServer(mux)
+	defer server.Close()
+
+	g := New(server.URL+"/sitemap_index.xml", "book_detail",
+		WithPattern(`/subject/\d+/$`),
+		WithSince(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)),
+		WithPriority(10),
+	)
+	reqs, err := g.Root()
+	assert.Nil(t, err)
+
+	var urls []string
+	for _, req := range reqs {
+		assert.Equal(t, "book_detail", req.RuleName)
+		assert.Equal(t, int64(10), req.Priority)
+		urls = append(urls, req.URL)
+	}
+	assert.Equal(t, []string{
+		"https://book.example.com/subject/1/",
+		"https://book.example.com/subject/3/",
+	}, urls)
+}
+
+func TestGenerator_Text(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("https://a.com/1\n\nhttps://a.com/2\n"))
+	}))
+	defer server.Close()
+
+	reqs, err := New(server.URL+"/sitemap.txt", "page").Root()
+	assert.Nil(t, err)
+	assert.Len(t, reqs, 2)
+
+	_, err = New(server.URL, "page", WithPattern("(")).Root()
+	assert.NotNil(t, err)
+}
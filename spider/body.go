@@ -0,0 +1,94 @@
+package spider
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// 设置表单请求体，method 为空时使用 POST
+func (r *Request) SetForm(values url.Values) {
+	r.Body = []byte(values.Encode())
+	r.setContentType("application/x-www-form-urlencoded")
+}
+
+// 设置 JSON 请求体，method 为空时使用 POST
+func (r *Request) SetJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	r.Body = data
+	r.setContentType("application/json")
+	return nil
+}
+
+func (r *Request) setContentType(ct string) {
+	if r.Method == "" || strings.EqualFold(r.Method, "GET") {
+		r.Method = "POST"
+	}
+	if r.Header == nil {
+		r.Header = make(http.Header)
+	}
+	r.Header.Set("Content-Type", ct)
+}
+
+func (r *Request) AddCookie(name, value string) {
+	r.Cookies = append(r.Cookies, &http.Cookie{Name: name, Value: value})
+}
+
+// 合并 Query 后的完整 URL
+func (r *Request) FullURL() string {
+	if len(r.Query) == 0 {
+		return r.URL
+	}
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return r.URL
+	}
+	q := u.Query()
+	for k, vs := range r.Query {
+		for _, v := range vs {
+			q.Add(k, v)
+		}
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// 请求使用的 method，为空时为 GET
+func (r *Request) HTTPMethod() string {
+	if r.Method == "" {
+		return "GET"
+	}
+	return strings.ToUpper(r.Method)
+}
+
+// 转换为 net/http 的请求，包括条件请求头，任务的 Cookie 由中间件添加
+func (r *Request) HTTPRequest() (*http.Request, error) {
+	var body io.Reader
+	if len(r.Body) > 0 {
+		body = bytes.NewReader(r.Body)
+	}
+	req, err := http.NewRequest(r.HTTPMethod(), r.FullURL(), body)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range r.Cookies {
+		req.AddCookie(c)
+	}
+	for k, vs := range r.Header {
+		req.Header[k] = vs
+	}
+	v := r.Validator
+	if v.ETag != "" {
+		req.Header.Set("If-None-Match", v.ETag)
+	}
+	if v.LastModified != "" {
+		req.Header.Set("If-Modified-Since", v.LastModified)
+	}
+	return req, nil
+}
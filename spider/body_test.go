@@ -0,0 +1,68 @@
+package spider
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/url"
+	"testing"
+)
+
+func TestRequest_Unique(t *testing.T) {
+	get := &Request{URL: "http://a.com/list", Method: "GET"}
+	block := md5.Sum([]byte("http://a.com/list" + "GET"))
+	// 没有请求体的请求与之前的唯一标识保持一致
+	assert.Equal(t, hex.EncodeToString(block[:]), get.Unique())
+
+	page1 := &Request{URL: "http://a.com/api"}
+	page1.SetForm(url.Values{"page": []string{"1"}})
+	page2 := &Request{URL: "http://a.com/api"}
+	page2.SetForm(url.Values{"page": []string{"2"}})
+	assert.NotEqual(t, page1.Unique(), page2.Unique())
+
+	q1 := &Request{URL: "http://a.com/api?a=1", Query: url.Values{"b": []string{"2"}}}
+	q2 := &Request{URL: "http://a.com/api?a=1&b=2"}
+	assert.Equal(t, q2.Unique(), q1.Unique())
+
+	// 规范化后相同的地址
+	same := []string{
+		"http://a.com/api?b=2&a=1",
+		"HTTP://A.com:80/api?a=1&b=2#top",
+		"http://a.com/api?a=1&b=2",
+	}
+	for _, u := range same {
+		assert.Equal(t, q2.Unique(), (&Request{URL: u}).Unique(), u)
+	}
+	assert.NotEqual(t, q2.Unique(), (&Request{URL: "http://a.com/api?a=1&b=3"}).Unique())
+
+	// 百分号编码的路径与之前原样使用中文路径的识别码一致
+	tag := md5.Sum([]byte("https://book.douban.com/tag/小说" + "GET"))
+	encoded := &Request{URL: "https://book.douban.com/tag/%E5%B0%8F%E8%AF%B4", Method: "GET"}
+	assert.Equal(t, hex.EncodeToString(tag[:]), encoded.Unique())
+	assert.Equal(t, encoded.Unique(), (&Request{URL: "https://book.douban.com/tag/小说", Method: "GET"}).Unique())
+}
+
+func TestRequest_HTTPRequest(t *testing.T) {
+	r := &Request{
+		Task: &Task{Options: Options{Cookie: "sid=1"}},
+		URL:  "http://a.com/api",
+	}
+	assert.Nil(t, r.SetJSON(map[string]int{"page": 2}))
+	r.AddCookie("token", "abc")
+	r.Validator = Validator{ETag: `"v1"`}
+
+	req, err := r.HTTPRequest()
+	assert.Nil(t, err)
+	assert.Equal(t, "POST", req.Method)
+	assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+	// 任务的 Cookie 由 Fetcher 的中间件添加
+	assert.Equal(t, "token=abc", req.Header.Get("Cookie"))
+	assert.Equal(t, `"v1"`, req.Header.Get("If-None-Match"))
+	body, _ := io.ReadAll(req.Body)
+	assert.Equal(t, `{"page":2}`, string(body))
+
+	rec := r.Record()
+	restored := rec.Request(r.Task)
+	assert.Equal(t, r.Unique(), restored.Unique())
+}
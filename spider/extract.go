@@ -0,0 +1,299 @@
+package spider
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+	"github.com/antchfx/htmlquery"
+	"github.com/antchfx/xpath"
+	"golang.org/x/net/html"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 字段的提取模式
+const (
+	ModeText = "text" // 节点及子节点的文本
+	ModeHTML = "html" // 节点内部的 HTML
+	ModeAttr = "attr" // 节点的属性
+)
+
+// 字段的类型
+const (
+	TypeString = "string"
+	TypeInt    = "int"
+	TypeFloat  = "float"
+	TypeBool   = "bool"
+)
+
+// 一个字段的提取规则，CSS 与 XPath 二选一
+type Field struct {
+	Name      string `json:"name"`
+	CSS       string `json:"css"`
+	XPath     string `json:"xpath"`
+	Mode      string `json:"mode"`       // text、html、attr，默认为 text，设置了 Attr 时默认为 attr
+	Attr      string `json:"attr"`       // 提取的属性，例如 href
+	Regexp    string `json:"regexp"`     // 对提取的值再做正则匹配，有分组时取第一个分组
+	KeepSpace bool   `json:"keep_space"` // 默认会去掉首尾的空白字符
+	Type      string `json:"type"`       // string、int、float、bool，默认为 string
+	Multiple  bool   `json:"multiple"`   // 返回所有匹配节点的值，否则只取第一个
+}
+
+// 声明式的提取规则
+// Scope 为空时整个页面提取为一个 item，否则 Scope 匹配的每个节点提取为一个 item，
+// 此时字段的选择器相对于该节点
+type Extraction struct {
+	Scope      string  `json:"scope"`       // CSS 选择器
+	ScopeXPath string  `json:"scope_xpath"` // 与 Scope 二选一
+	Fields     []Field `json:"fields"`
+
+	once     sync.Once
+	err      error
+	scope    *xpath.Expr
+	xpaths   []*xpath.Expr
+	patterns []*regexp.Regexp
+}
+
+// 字段名，按声明的顺序
+func (e *Extraction) Names() []string {
+	names := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+// 编译选择器与正则，任务加载时调用以便尽早发现有误的规则
+func (e *Extraction) Compile() error {
+	if e == nil {
+		return nil
+	}
+	e.once.Do(func() {
+		if e.Scope != "" {
+			if _, e.err = cascadia.Compile(e.Scope); e.err != nil {
+				return
+			}
+		}
+		if e.ScopeXPath != "" {
+			if e.scope, e.err = xpath.Compile(e.ScopeXPath); e.err != nil {
+				return
+			}
+		}
+		e.xpaths = make([]*xpath.Expr, len(e.Fields))
+		e.patterns = make([]*regexp.Regexp, len(e.Fields))
+		for i, f := range e.Fields {
+			switch {
+			case f.CSS != "" && f.XPath != "":
+				e.err = fmt.Errorf("field %s: css and xpath are exclusive", f.Name)
+			case f.CSS != "":
+				_, e.err = cascadia.Compile(f.CSS)
+			case f.XPath != "":
+				e.xpaths[i], e.err = xpath.Compile(f.XPath)
+			default:
+				e.err = fmt.Errorf("field %s: css or xpath is required", f.Name)
+			}
+			if e.err != nil {
+				e.err = fmt.Errorf("field %s:%w", f.Name, e.err)
+				return
+			}
+			if f.Regexp != "" {
+				if e.patterns[i], e.err = regexp.Compile(f.Regexp); e.err != nil {
+					return
+				}
+			}
+			switch f.Type {
+			case "", TypeString, TypeInt, TypeFloat, TypeBool:
+			default:
+				e.err = fmt.Errorf("field %s: unknown type %s", f.Name, f.Type)
+				return
+			}
+		}
+	})
+	return e.err
+}
+
+// 从节点中提取 item
+func (e *Extraction) Extract(root *html.Node) ([]map[string]interface{}, error) {
+	if err := e.Compile(); err != nil {
+		return nil, fmt.Errorf("compile extraction failed:%w", err)
+	}
+	roots := []*html.Node{root}
+	switch {
+	case e.Scope != "":
+		roots = goquery.NewDocumentFromNode(root).Find(e.Scope).Nodes
+	case e.scope != nil:
+		roots = htmlquery.QuerySelectorAll(root, e.scope)
+	}
+
+	items := make([]map[string]interface{}, 0, len(roots))
+	for _, r := range roots {
+		item := make(map[string]interface{}, len(e.Fields))
+		for i := range e.Fields {
+			v, err := e.field(i, r)
+			if err != nil {
+				return nil, err
+			}
+			item[e.Fields[i].Name] = v
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (e *Extraction) field(i int, root *html.Node) (interface{}, error) {
+	f := &e.Fields[i]
+	var nodes []*html.Node
+	if e.xpaths[i] != nil {
+		nodes = htmlquery.QuerySelectorAll(root, e.xpaths[i])
+	} else {
+		nodes = goquery.NewDocumentFromNode(root).Find(f.CSS).Nodes
+	}
+
+	var values []interface{}
+	for _, n := range nodes {
+		s, ok := f.raw(n)
+		if !ok {
+			continue
+		}
+		if re := e.patterns[i]; re != nil {
+			m := re.FindStringSubmatch(s)
+			if m == nil {
+				continue
+			}
+			s = m[0]
+			if len(m) > 1 {
+				s = m[1]
+			}
+		}
+		if !f.KeepSpace {
+			s = strings.TrimSpace(s)
+		}
+		v, err := convert(s, f.Type)
+		if err != nil {
+			return nil, fmt.Errorf("field %s:%w", f.Name, err)
+		}
+		values = append(values, v)
+		if !f.Multiple {
+			break
+		}
+	}
+	if f.Multiple {
+		return values, nil
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+	return values[0], nil
+}
+
+// 按模式读取节点的值，属性不存在时返回 false
+func (f *Field) raw(n *html.Node) (string, bool) {
+	mode := f.Mode
+	if mode == "" {
+		mode = ModeText
+		if f.Attr != "" {
+			mode = ModeAttr
+		}
+	}
+	switch mode {
+	case ModeHTML:
+		var buf bytes.Buffer
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if err := html.Render(&buf, c); err != nil {
+				return "", false
+			}
+		}
+		return buf.String(), true
+	case ModeAttr:
+		for _, a := range n.Attr {
+			if a.Key == f.Attr {
+				return a.Val, true
+			}
+		}
+		return "", false
+	default:
+		return htmlquery.InnerText(n), true
+	}
+}
+
+// 空字符串转换为 nil
+func convert(s string, typ string) (interface{}, error) {
+	switch typ {
+	case TypeInt:
+		if s == "" {
+			return nil, nil
+		}
+		return strconv.Atoi(strings.ReplaceAll(s, ",", ""))
+	case TypeFloat:
+		if s == "" {
+			return nil, nil
+		}
+		return strconv.ParseFloat(strings.ReplaceAll(s, ",", ""), 64)
+	case TypeBool:
+		if s == "" {
+			return nil, nil
+		}
+		return strconv.ParseBool(s)
+	default:
+		return s, nil
+	}
+}
+
+// 解析后的 DOM，多次调用只解析一次
+func (c *Context) Node() (*html.Node, error) {
+	if c.node == nil {
+		n, err := html.Parse(bytes.NewReader(c.Body))
+		if err != nil {
+			return nil, fmt.Errorf("parse html failed:%w", err)
+		}
+		c.node = n
+	}
+	return c.node, nil
+}
+
+// 使用 CSS 选择器查询的文档
+func (c *Context) Doc() (*goquery.Document, error) {
+	n, err := c.Node()
+	if err != nil {
+		return nil, err
+	}
+	return goquery.NewDocumentFromNode(n), nil
+}
+
+// 按 XPath 查询节点
+func (c *Context) XPath(expr string) ([]*html.Node, error) {
+	n, err := c.Node()
+	if err != nil {
+		return nil, err
+	}
+	return htmlquery.QueryAll(n, expr)
+}
+
+// 按提取规则从页面中提取数据
+func (c *Context) Extract(e *Extraction) ([]map[string]interface{}, error) {
+	n, err := c.Node()
+	if err != nil {
+		return nil, err
+	}
+	return e.Extract(n)
+}
+
+// 按提取规则提取数据，并转换为 DataCell
+func (c *Context) ExtractItems(e *Extraction) ([]interface{}, error) {
+	datas, err := c.Extract(e)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]interface{}, 0, len(datas))
+	for _, d := range datas {
+		cell, err := c.Output(d)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, cell)
+	}
+	return items, nil
+}
@@ -0,0 +1,95 @@
+package spider
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+const bookHTML = `<html><body>
+<h1><span property="v:itemreviewed">  小王子 </span></h1>
+<div id="info">
+  <span class="pl">页数:</span> 97<br/>
+  <a class="author" href="/author/1">圣埃克苏佩里</a>
+</div>
+<strong class="rating_num">9.1</strong>
+<div class="intro"><p>一个<b>超凡脱俗</b>的仙童</p></div>
+<ul>
+  <li class="item"><a href="/subject/1" title="A">A</a><span class="price">1,024</span></li>
+  <li class="item"><a href="/subject/2" title="B">B</a></li>
+</ul>
+</body></html>`
+
+func TestExtraction(t *testing.T) {
+	ctx := &Context{Body: []byte(bookHTML), Req: &Request{Task: &Task{Options: Options{Name: "book"}}, RuleName: "书籍简介"}}
+
+	detail := &Extraction{Fields: []Field{
+		{Name: "书名", CSS: "h1 span"},
+		{Name: "作者", XPath: `//a[@class="author"]`},
+		{Name: "作者主页", CSS: "a.author", Attr: "href"},
+		{Name: "页数", XPath: `//div[@id="info"]`, Regexp: `页数:\s*(\d+)`, Type: TypeInt},
+		{Name: "得分", CSS: ".rating_num", Type: TypeFloat},
+		{Name: "简介", CSS: ".intro p", Mode: ModeHTML},
+		{Name: "链接", XPath: `//li/a/@href`, Multiple: true},
+		{Name: "缺失", CSS: ".missing"},
+	}}
+	items, err := ctx.Extract(detail)
+	assert.Nil(t, err)
+	assert.Len(t, items, 1)
+	book := items[0]
+	assert.Equal(t, "小王子", book["书名"])
+	assert.Equal(t, "圣埃克苏佩里", book["作者"])
+	assert.Equal(t, "/author/1", book["作者主页"])
+	assert.Equal(t, 97, book["页数"])
+	assert.Equal(t, 9.1, book["得分"])
+	assert.Equal(t, "一个<b>超凡脱俗</b>的仙童", book["简介"])
+	assert.Equal(t, []interface{}{"/subject/1", "/subject/2"}, book["链接"])
+	assert.Nil(t, book["缺失"])
+
+	list := &Extraction{Scope: "li.item", Fields: []Field{
+		{Name: "title", XPath: `./a/@title`},
+		{Name: "price", CSS: ".price", Type: TypeInt},
+	}}
+	items, err = ctx.Extract(list)
+	assert.Nil(t, err)
+	assert.Equal(t, []map[string]interface{}{{"title": "A", "price": 1024}, {"title": "B", "price": nil}}, items)
+	assert.Equal(t, []string{"title", "price"}, (&Rule{Extract: list}).Fields())
+
+	ctx.Req.Task.Rule.Trunk = map[string]*Rule{"书籍简介": {Extract: list}}
+	cells, err := ctx.ExtractItems(list)
+	assert.Nil(t, err)
+	assert.Equal(t, "book", cells[0].(*DataCell).GetTaskName())
+
+	for _, bad := range []*Extraction{
+		{Fields: []Field{{Name: "a"}}},
+		{Fields: []Field{{Name: "a", CSS: "a", XPath: "//a"}}},
+		{Fields: []Field{{Name: "a", XPath: "//a["}}},
+		{Fields: []Field{{Name: "a", CSS: "a", Type: "date"}}},
+		{Fields: []Field{{Name: "a", CSS: "a.author", Type: TypeInt}}},
+	} {
+		_, err := ctx.Extract(bad)
+		assert.NotNil(t, err)
+	}
+}
+
+func TestTask_Compile(t *testing.T) {
+	good := &Task{Rule: RuleTree{Trunk: map[string]*Rule{
+		"list": {
+			Extract:  &Extraction{Scope: "li.item", Fields: []Field{{Name: "title", CSS: "a"}}},
+			Paginate: &Pagination{Next: "a.next"},
+		},
+		"tag": {Paginate: &Pagination{Template: "http://a.com/tag?page={page}"}},
+	}}}
+	assert.Nil(t, good.Compile())
+
+	// 加载任务时发现有误的提取与分页规则，而不是在解析时才失败
+	for _, rule := range []*Rule{
+		{Extract: &Extraction{Scope: "li["}},
+		{Extract: &Extraction{Fields: []Field{{Name: "a", XPath: "//a["}}}},
+		{Paginate: &Pagination{Next: "a["}},
+		{Paginate: &Pagination{}},
+		{Validation: &Validation{Required: []string{"("}}},
+	} {
+		task := &Task{Rule: RuleTree{Trunk: map[string]*Rule{"list": rule}}}
+		assert.NotNil(t, task.Compile())
+	}
+}
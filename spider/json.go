@@ -0,0 +1,254 @@
+package spider
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var jsonpRe = regexp.MustCompile(`^\s*(?:/\*\*/\s*)?(?:typeof\s+[\w$.]+\s*===?\s*['"]function['"]\s*&&\s*)?[\w$.]+\s*\(([\s\S]*)\)\s*;?\s*$`)
+
+// 去掉 JSONP 的回调函数包装，例如 callback({...});，不是 JSONP 时原样返回
+func UnwrapJSONP(body []byte) []byte {
+	trimmed := strings.TrimSpace(string(body))
+	if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		return body
+	}
+	if m := jsonpRe.FindSubmatch(body); m != nil {
+		return m[1]
+	}
+	return body
+}
+
+// 路径中的一段，wildcard 为 true 时匹配对象的所有值或数组的所有元素
+type jsonStep struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// 解析路径，例如 $.data.items[*].title、items[0]、["key with.dot"]
+func parseJSONPath(path string) ([]jsonStep, bool, error) {
+	var steps []jsonStep
+	wildcard := false
+	p := strings.TrimPrefix(strings.TrimSpace(path), "$")
+	for i := 0; i < len(p); {
+		switch p[i] {
+		case '.':
+			i++
+		case '[':
+			end := strings.IndexByte(p[i:], ']')
+			if end < 0 {
+				return nil, false, fmt.Errorf("invalid json path %s: missing ]", path)
+			}
+			s := strings.TrimSpace(p[i+1 : i+end])
+			i += end + 1
+			switch {
+			case s == "*":
+				steps = append(steps, jsonStep{wildcard: true})
+				wildcard = true
+			case len(s) >= 2 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0]:
+				steps = append(steps, jsonStep{key: s[1 : len(s)-1]})
+			default:
+				n, err := strconv.Atoi(s)
+				if err != nil {
+					return nil, false, fmt.Errorf("invalid json path %s: bad index %s", path, s)
+				}
+				steps = append(steps, jsonStep{index: n, isIndex: true})
+			}
+		default:
+			end := strings.IndexAny(p[i:], ".[")
+			if end < 0 {
+				end = len(p) - i
+			}
+			key := p[i : i+end]
+			i += end
+			if key == "*" {
+				steps = append(steps, jsonStep{wildcard: true})
+				wildcard = true
+			} else {
+				steps = append(steps, jsonStep{key: key})
+			}
+		}
+	}
+	return steps, wildcard, nil
+}
+
+func (s jsonStep) apply(v interface{}) []interface{} {
+	switch node := v.(type) {
+	case map[string]interface{}:
+		if s.wildcard {
+			keys := make([]string, 0, len(node))
+			for k := range node {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			res := make([]interface{}, 0, len(keys))
+			for _, k := range keys {
+				res = append(res, node[k])
+			}
+			return res
+		}
+		if s.isIndex {
+			return nil
+		}
+		if child, ok := node[s.key]; ok {
+			return []interface{}{child}
+		}
+	case []interface{}:
+		if s.wildcard {
+			return node
+		}
+		if !s.isIndex {
+			return nil
+		}
+		i := s.index
+		if i < 0 {
+			i += len(node)
+		}
+		if i >= 0 && i < len(node) {
+			return []interface{}{node[i]}
+		}
+	}
+	return nil
+}
+
+// 按路径选择 JSON 中的值，路径不存在时返回空
+// 路径以 . 分隔对象的字段，[n] 选择数组的元素（负数从末尾开始），* 或 [*] 选择所有的值
+func SelectJSON(v interface{}, path string) ([]interface{}, error) {
+	steps, _, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+	nodes := []interface{}{v}
+	for _, s := range steps {
+		var next []interface{}
+		for _, n := range nodes {
+			next = append(next, s.apply(n)...)
+		}
+		nodes = next
+	}
+	return nodes, nil
+}
+
+// 解析后的 JSON，支持 JSONP，多次调用只解析一次
+func (c *Context) JSON() (interface{}, error) {
+	if c.json == nil {
+		var v interface{}
+		if err := json.Unmarshal(UnwrapJSONP(c.Body), &v); err != nil {
+			return nil, fmt.Errorf("parse json failed:%w", err)
+		}
+		c.json = &v
+	}
+	return *c.json, nil
+}
+
+// 按路径选择 JSON 中的值
+func (c *Context) JSONPath(path string) ([]interface{}, error) {
+	v, err := c.JSON()
+	if err != nil {
+		return nil, err
+	}
+	return SelectJSON(v, path)
+}
+
+// 将路径选择的地址转换为 ruleName 规则的请求，相对地址按页面地址解析，不是字符串的值会被忽略
+func (c *Context) JSONRequests(path string, ruleName string) ([]*Request, error) {
+	values, err := c.JSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+	base, err := c.BaseURL()
+	if err != nil {
+		return nil, err
+	}
+	reqs := make([]*Request, 0, len(values))
+	for _, v := range values {
+		s, ok := v.(string)
+		if !ok || s == "" {
+			continue
+		}
+		u, err := base.Parse(s)
+		if err != nil {
+			return nil, err
+		}
+		reqs = append(reqs, &Request{
+			Method:   "GET",
+			Task:     c.Req.Task,
+			URL:      u.String(),
+			Depth:    c.Req.Depth + 1,
+			RuleName: ruleName,
+		})
+	}
+	return reqs, nil
+}
+
+// 将路径选择的每个对象转换为 item
+// fields 为 item 字段到对象内路径的映射，路径中有 * 时字段的值为数组，否则为第一个值；
+// fields 为空时取对象中与规则 Schema 同名的字段，忽略其他字段；item 按当前规则的 Schema 校验，规则需要声明字段
+func (c *Context) JSONItems(path string, fields map[string]string) ([]interface{}, error) {
+	values, err := c.JSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	if len(fields) == 0 && c.Req.Task != nil {
+		if rule := c.GetRule(c.Req.RuleName); rule != nil {
+			names = rule.Fields()
+		}
+	}
+	items := make([]interface{}, 0, len(values))
+	for _, v := range values {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: expect object, got %T", path, v)
+		}
+		data := obj
+		if len(fields) > 0 {
+			data = make(map[string]interface{}, len(fields))
+			for name, p := range fields {
+				if data[name], err = selectField(obj, p); err != nil {
+					return nil, err
+				}
+			}
+		} else if names != nil {
+			data = make(map[string]interface{}, len(names))
+			for _, name := range names {
+				if v, ok := obj[name]; ok {
+					data[name] = v
+				}
+			}
+		}
+		cell, err := c.Output(data)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, cell)
+	}
+	return items, nil
+}
+
+func selectField(obj interface{}, path string) (interface{}, error) {
+	_, wildcard, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+	values, err := SelectJSON(obj, path)
+	if err != nil {
+		return nil, err
+	}
+	if wildcard {
+		if values == nil {
+			values = []interface{}{}
+		}
+		return values, nil
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+	return values[0], nil
+}
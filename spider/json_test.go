@@ -0,0 +1,92 @@
+package spider
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestUnwrapJSONP(t *testing.T) {
+	cases := map[string]string{
+		`{"a":1}`:                     `{"a":1}`,
+		` [1,2] `:                     ` [1,2] `,
+		`cb({"a":1});`:                `{"a":1}`,
+		`/**/ jQuery123_456({"a":1})`: `{"a":1}`,
+		"window.cb(\n[1, 2]\n);\n":    "\n[1, 2]\n",
+		`typeof cb === 'function' && cb({"a":(1)});`: `{"a":(1)}`,
+		`not json`: `not json`,
+	}
+	for in, want := range cases {
+		assert.Equal(t, want, string(UnwrapJSONP([]byte(in))), in)
+	}
+}
+
+func TestSelectJSON(t *testing.T) {
+	ctx := &Context{Body: []byte(`cb({
+		"data": {
+			"total": 3,
+			"items": [
+				{"id": 1, "title": "a", "url": "/item/1", "tags": ["x", "y"], "author": {"name": "n1"}},
+				{"id": 2, "title": "b", "url": "https://other.com/item/2", "tags": []},
+				{"id": 3.5, "title": "c"}
+			],
+			"key.with.dot": true
+		}
+	})`), Req: &Request{Task: &Task{}, URL: "https://example.com/api/list?page=1", Depth: 2, RuleName: "list"}}
+	ctx.Req.Task.Rule.Trunk = map[string]*Rule{"list": {ItemFields: []string{"name", "tags", "author"}}}
+
+	cases := []struct {
+		path string
+		want []interface{}
+	}{
+		{"data.total", []interface{}{float64(3)}},
+		{"$.data.items[*].title", []interface{}{"a", "b", "c"}},
+		{"data.items.*.id", []interface{}{float64(1), float64(2), 3.5}},
+		{"data.items[-1].title", []interface{}{"c"}},
+		{"data.items[0].tags[*]", []interface{}{"x", "y"}},
+		{"data.items[*].author.name", []interface{}{"n1"}},
+		{`data["key.with.dot"]`, []interface{}{true}},
+		{"data.items[9]", nil},
+		{"data.missing.x", nil},
+		{"data.total[0]", nil},
+	}
+	for _, c := range cases {
+		got, err := ctx.JSONPath(c.path)
+		assert.Nil(t, err, c.path)
+		assert.Equal(t, c.want, got, c.path)
+	}
+	_, err := ctx.JSONPath("data.items[x]")
+	assert.NotNil(t, err)
+	_, err = ctx.JSONPath("data.items[0")
+	assert.NotNil(t, err)
+
+	reqs, err := ctx.JSONRequests("data.items[*].url", "detail")
+	assert.Nil(t, err)
+	assert.Len(t, reqs, 2)
+	assert.Equal(t, "https://example.com/item/1", reqs[0].URL)
+	assert.Equal(t, "https://other.com/item/2", reqs[1].URL)
+	assert.Equal(t, "detail", reqs[0].RuleName)
+	assert.Equal(t, int64(3), reqs[0].Depth)
+
+	items, err := ctx.JSONItems("data.items[*]", map[string]string{"name": "title", "tags": "tags[*]", "author": "author.name"})
+	assert.Nil(t, err)
+	assert.Len(t, items, 3)
+	assert.Equal(t, map[string]interface{}{"name": "a", "tags": []interface{}{"x", "y"}, "author": "n1"}, items[0].(*DataCell).Data)
+	assert.Equal(t, map[string]interface{}{"name": "c", "tags": []interface{}{}, "author": nil}, items[2].(*DataCell).Data)
+
+	items, err = ctx.JSONItems("data.items[0].author", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"name": "n1"}, items[0].(*DataCell).Data)
+
+	// 省略 fields 时只保留 Schema 中声明的字段，对象中的其他字段被忽略
+	items, err = ctx.JSONItems("data.items[*]", nil)
+	assert.Nil(t, err)
+	assert.Len(t, items, 3)
+	assert.Equal(t, map[string]interface{}{"tags": []interface{}{"x", "y"}, "author": map[string]interface{}{"name": "n1"}}, items[0].(*DataCell).Data)
+	assert.Equal(t, map[string]interface{}{}, items[2].(*DataCell).Data)
+
+	_, err = ctx.JSONItems("data.total", nil)
+	assert.NotNil(t, err)
+
+	_, err = (&Context{Body: []byte(`<html></html>`), Req: &Request{}}).JSON()
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,247 @@
+package spider
+
+import (
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// 默认去掉的跟踪参数，以 * 结尾时按前缀匹配
+var TrackingParams = []string{"utm_*", "fbclid", "gclid", "spm"}
+
+// 规范化 URL：小写的 scheme 与域名，去掉默认端口与 fragment，查询参数按名称排序，
+// 去掉 strip 中的参数；trimSlash 为 true 时去掉路径末尾的 /
+func Canonicalize(u *url.URL, strip []string, trimSlash bool) *url.URL {
+	c := *u
+	c.Scheme = strings.ToLower(c.Scheme)
+	host, port := strings.ToLower(c.Hostname()), c.Port()
+	if (c.Scheme == "http" && port == "80") || (c.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	c.Host = host
+	if port != "" {
+		c.Host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		c.Host = "[" + host + "]"
+	}
+	c.Fragment, c.RawFragment = "", ""
+
+	if c.Path == "" {
+		c.Path, c.RawPath = "/", ""
+	}
+	if trimSlash && len(c.Path) > 1 && strings.HasSuffix(c.Path, "/") {
+		c.Path = strings.TrimRight(c.Path, "/")
+		c.RawPath = strings.TrimRight(c.RawPath, "/")
+		if c.Path == "" {
+			c.Path, c.RawPath = "/", ""
+		}
+	}
+
+	query := c.Query()
+	for name := range query {
+		if matchParam(name, strip) {
+			query.Del(name)
+		}
+	}
+	// Encode 按参数名排序
+	c.RawQuery = query.Encode()
+	c.ForceQuery = false
+	return &c
+}
+
+func matchParam(name string, patterns []string) bool {
+	for _, p := range patterns {
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == p {
+			return true
+		}
+	}
+	return false
+}
+
+// 规范化 URL 字符串，见 Canonicalize，使用默认的跟踪参数
+func CanonicalURL(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	return Canonicalize(u, TrackingParams, false).String(), nil
+}
+
+// 从页面中提取链接，相对地址按最终的响应地址（或页面的 <base>）解析，
+// 规范化后按域名与正则过滤，并去掉重复的链接
+type LinkExtractor struct {
+	CSS         string   // 链接节点的选择器，默认为 a[href]
+	Attr        string   // 默认为 href
+	Allow       []string // 规范化后的地址需要匹配其中一个，为空时不限制
+	Deny        []string // 匹配其中一个的地址会被丢弃，优先于 Allow
+	Domains     []string // 允许的域名，包括其子域名，为空时不限制
+	SameHost    bool     // 只保留与页面相同域名的链接
+	StripParams []string // 去掉的查询参数，为 nil 时使用 TrackingParams
+	TrimSlash   bool     // 去掉路径末尾的 /
+	RuleName    string   // 生成的请求使用的规则
+	Priority    int64
+
+	once  sync.Once
+	err   error
+	allow []*regexp.Regexp
+	deny  []*regexp.Regexp
+}
+
+func (e *LinkExtractor) compile() error {
+	e.once.Do(func() {
+		compile := func(exprs []string) ([]*regexp.Regexp, error) {
+			res := make([]*regexp.Regexp, 0, len(exprs))
+			for _, expr := range exprs {
+				re, err := regexp.Compile(expr)
+				if err != nil {
+					return nil, err
+				}
+				res = append(res, re)
+			}
+			return res, nil
+		}
+		if e.allow, e.err = compile(e.Allow); e.err != nil {
+			return
+		}
+		e.deny, e.err = compile(e.Deny)
+	})
+	return e.err
+}
+
+func (e *LinkExtractor) inDomains(host string) bool {
+	if len(e.Domains) == 0 {
+		return true
+	}
+	for _, d := range e.Domains {
+		d = strings.ToLower(d)
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// 链接是否满足过滤条件，base 为页面地址
+func (e *LinkExtractor) accept(u *url.URL, base *url.URL) bool {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+	host := u.Hostname()
+	if e.SameHost && host != strings.ToLower(base.Hostname()) {
+		return false
+	}
+	if !e.inDomains(host) {
+		return false
+	}
+	s := u.String()
+	for _, re := range e.deny {
+		if re.MatchString(s) {
+			return false
+		}
+	}
+	if len(e.allow) == 0 {
+		return true
+	}
+	for _, re := range e.allow {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// 按规则提取页面中的链接，返回规范化后的地址
+func (e *LinkExtractor) Links(doc *goquery.Document, base *url.URL) ([]string, error) {
+	if err := e.compile(); err != nil {
+		return nil, fmt.Errorf("compile link extractor failed:%w", err)
+	}
+	if href, ok := doc.Find("base[href]").First().Attr("href"); ok {
+		if b, err := base.Parse(strings.TrimSpace(href)); err == nil {
+			base = b
+		}
+	}
+	css, attr := e.CSS, e.Attr
+	if css == "" {
+		css = "a[href]"
+	}
+	if attr == "" {
+		attr = "href"
+	}
+	strip := e.StripParams
+	if strip == nil {
+		strip = TrackingParams
+	}
+
+	var links []string
+	seen := make(map[string]bool)
+	doc.Find(css).Each(func(_ int, s *goquery.Selection) {
+		ref, ok := s.Attr(attr)
+		if !ok {
+			return
+		}
+		u, err := base.Parse(strings.TrimSpace(ref))
+		if err != nil {
+			return
+		}
+		u = Canonicalize(u, strip, e.TrimSlash)
+		if !e.accept(u, base) {
+			return
+		}
+		link := u.String()
+		if !seen[link] {
+			seen[link] = true
+			links = append(links, link)
+		}
+	})
+	return links, nil
+}
+
+// 页面的地址，发生重定向时为最终的地址
+func (c *Context) BaseURL() (*url.URL, error) {
+	raw := c.Req.URL
+	if c.Resp != nil && c.Resp.URL != "" {
+		raw = c.Resp.URL
+	}
+	return url.Parse(raw)
+}
+
+// 按规则提取页面中的链接
+func (c *Context) Links(e *LinkExtractor) ([]string, error) {
+	base, err := c.BaseURL()
+	if err != nil {
+		return nil, err
+	}
+	doc, err := c.Doc()
+	if err != nil {
+		return nil, err
+	}
+	return e.Links(doc, base)
+}
+
+// 按规则提取页面中的链接，生成 e.RuleName 规则的请求
+func (c *Context) Follow(e *LinkExtractor) ([]*Request, error) {
+	links, err := c.Links(e)
+	if err != nil {
+		return nil, err
+	}
+	reqs := make([]*Request, 0, len(links))
+	for _, link := range links {
+		reqs = append(reqs, &Request{
+			Method:   "GET",
+			Task:     c.Req.Task,
+			URL:      link,
+			Depth:    c.Req.Depth + 1,
+			Priority: e.Priority,
+			RuleName: e.RuleName,
+		})
+	}
+	return reqs, nil
+}
@@ -0,0 +1,94 @@
+package spider
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/url"
+	"testing"
+)
+
+func TestCanonicalize(t *testing.T) {
+	cases := []struct {
+		raw       string
+		trimSlash bool
+		want      string
+	}{
+		{"HTTP://Book.Douban.COM:80/tag?b=2&a=1#top", false, "http://book.douban.com/tag?a=1&b=2"},
+		{"https://example.com:443", false, "https://example.com/"},
+		{"https://example.com:8443/a/?utm_source=x&utm_medium=y&id=3&fbclid=z", false, "https://example.com:8443/a/?id=3"},
+		{"https://example.com/a/b/", true, "https://example.com/a/b"},
+		{"https://example.com/", true, "https://example.com/"},
+		{"https://[::1]:443/?", false, "https://[::1]/"},
+	}
+	for _, c := range cases {
+		u, err := url.Parse(c.raw)
+		assert.Nil(t, err)
+		assert.Equal(t, c.want, Canonicalize(u, TrackingParams, c.trimSlash).String(), c.raw)
+	}
+
+	a, _ := CanonicalURL("https://example.com/list?b=2&a=1")
+	b, _ := CanonicalURL("https://example.com/list?a=1&b=2#page")
+	assert.Equal(t, a, b)
+	assert.Equal(t, (&Request{URL: a}).Unique(), (&Request{URL: b}).Unique())
+}
+
+const linkPage = `<html><body>
+<a href="/tag/a?b=2&a=1">a</a>
+<a href="/tag/a?a=1&b=2#more">same</a>
+<a href="tag/b/?utm_source=home">relative</a>
+<a href="https://sub.example.com/tag/c">subdomain</a>
+<a href="https://other.com/tag/d">other</a>
+<a href="/tag/ads">ads</a>
+<a href="/about">about</a>
+<a href="javascript:void(0)">js</a>
+<a href="mailto:a@example.com">mail</a>
+</body></html>`
+
+func TestFollow(t *testing.T) {
+	task := &Task{}
+	ctx := &Context{
+		Body: []byte(linkPage),
+		Req:  &Request{Task: task, URL: "https://example.com/old", Depth: 1},
+		// 相对地址按重定向后的地址解析
+		Resp: &Response{URL: "https://Example.com/dir/index.html"},
+	}
+
+	e := &LinkExtractor{Allow: []string{`/tag/`}, Deny: []string{`/ads$`}, TrimSlash: true, RuleName: "list", Priority: 2}
+	reqs, err := ctx.Follow(e)
+	assert.Nil(t, err)
+	var urls []string
+	for _, r := range reqs {
+		urls = append(urls, r.URL)
+		assert.Equal(t, task, r.Task)
+		assert.Equal(t, int64(2), r.Depth)
+		assert.Equal(t, int64(2), r.Priority)
+		assert.Equal(t, "list", r.RuleName)
+	}
+	assert.Equal(t, []string{
+		"https://example.com/tag/a?a=1&b=2",
+		"https://example.com/dir/tag/b",
+		"https://sub.example.com/tag/c",
+		"https://other.com/tag/d",
+	}, urls)
+
+	links, err := ctx.Links(&LinkExtractor{Domains: []string{"example.com"}, Allow: []string{`/tag/`}})
+	assert.Nil(t, err)
+	assert.Len(t, links, 4)
+	assert.NotContains(t, links, "https://other.com/tag/d")
+
+	links, err = ctx.Links(&LinkExtractor{SameHost: true, Allow: []string{`/tag/`}})
+	assert.Nil(t, err)
+	assert.Len(t, links, 3)
+	assert.NotContains(t, links, "https://sub.example.com/tag/c")
+
+	// 页面声明了 <base> 时按 <base> 解析
+	ctx = &Context{
+		Body: []byte(`<html><head><base href="https://cdn.example.com/x/"></head><body><a href="y">y</a></body></html>`),
+		Req:  &Request{URL: "https://example.com/"},
+	}
+	links, err = ctx.Links(&LinkExtractor{})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"https://cdn.example.com/x/y"}, links)
+
+	_, err = ctx.Links(&LinkExtractor{Allow: []string{`(`}})
+	assert.NotNil(t, err)
+}
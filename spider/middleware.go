@@ -0,0 +1,67 @@
+package spider
+
+import (
+	"fmt"
+	"sync"
+)
+
+// 将普通函数转换为 Fetcher
+type FetchFunc func(*Request) (*Response, error)
+
+func (f FetchFunc) Get(req *Request) (*Response, error) {
+	return f(req)
+}
+
+// Middleware 包装 Fetcher，在请求发出前后执行额外的逻辑，例如添加请求头、签名、校验响应
+// 中间件应当将原请求交给下一个 Fetcher，内层记录在请求上的信息(例如 Request.Proxy)才能被外层与引擎看到
+type Middleware func(next Fetcher) Fetcher
+
+// 按顺序包装 Fetcher，第一个中间件最先处理请求、最后处理响应
+func Chain(f Fetcher, mws ...Middleware) Fetcher {
+	for i := len(mws) - 1; i >= 0; i-- {
+		f = mws[i](f)
+	}
+	return f
+}
+
+// 根据配置参数创建中间件
+type MiddlewareFactory func(args map[string]string) (Middleware, error)
+
+type MiddlewareConfig struct {
+	Name string
+	Args map[string]string
+}
+
+var (
+	middlewares    = make(map[string]MiddlewareFactory)
+	middlewareLock sync.RWMutex
+)
+
+// 注册中间件，之后可以在任务配置中通过名称使用，通常在 init 中调用
+func RegisterMiddleware(name string, f MiddlewareFactory) {
+	middlewareLock.Lock()
+	defer middlewareLock.Unlock()
+	if _, ok := middlewares[name]; ok {
+		panic("middleware already registered: " + name)
+	}
+	middlewares[name] = f
+}
+
+// 根据任务配置创建中间件
+func NewMiddlewares(cfgs []MiddlewareConfig) ([]Middleware, error) {
+	middlewareLock.RLock()
+	defer middlewareLock.RUnlock()
+	mws := make([]Middleware, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		f, ok := middlewares[cfg.Name]
+		if !ok {
+			return nil, fmt.Errorf("unknown middleware:%s", cfg.Name)
+		}
+		mw, err := f(cfg.Args)
+		if err != nil {
+			return nil, fmt.Errorf("create middleware %s failed:%w", cfg.Name, err)
+		}
+		mws = append(mws, mw)
+	}
+	return mws, nil
+}
@@ -0,0 +1,42 @@
+package spider
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func trace(name string, calls *[]string) Middleware {
+	return func(next Fetcher) Fetcher {
+		return FetchFunc(func(req *Request) (*Response, error) {
+			*calls = append(*calls, name+" before")
+			resp, err := next.Get(req)
+			*calls = append(*calls, name+" after")
+			return resp, err
+		})
+	}
+}
+
+func TestChain(t *testing.T) {
+	var calls []string
+	f := Chain(FetchFunc(func(req *Request) (*Response, error) {
+		calls = append(calls, "fetch")
+		return &Response{URL: req.URL}, nil
+	}), trace("a", &calls), trace("b", &calls))
+
+	resp, err := f.Get(&Request{URL: "http://a.com"})
+	assert.Nil(t, err)
+	assert.Equal(t, "http://a.com", resp.URL)
+	assert.Equal(t, []string{"a before", "b before", "fetch", "b after", "a after"}, calls)
+}
+
+func TestNewMiddlewares(t *testing.T) {
+	RegisterMiddleware("test_noop", func(args map[string]string) (Middleware, error) {
+		return func(next Fetcher) Fetcher { return next }, nil
+	})
+	mws, err := NewMiddlewares([]MiddlewareConfig{{Name: "test_noop"}})
+	assert.Nil(t, err)
+	assert.Len(t, mws, 1)
+
+	_, err = NewMiddlewares([]MiddlewareConfig{{Name: "unknown"}})
+	assert.NotNil(t, err)
+}
@@ -3,6 +3,7 @@ package spider
 import (
 	"go.uber.org/zap"
 	"gocrawler/limiter"
+	"time"
 )
 
 type Options struct {
@@ -12,9 +13,15 @@ type Options struct {
 	WaitTime int64  `json:"wait_time"` // 随机休眠时间，秒
 	Reload   bool   `json:"reload"`    // 网站是否可以重复爬取
 	MaxDepth int64  `json:"max_depth"`
+	Weight   int    `json:"weight"` // 多个任务共享 worker 时的调度权重
 	Fetcher  Fetcher
 	Storage  Storage
 	Limit    limiter.RateLimiter
+	Retry    RetryPolicy
+	Robots   RobotsChecker            // 为空时不检查 robots.txt
+	Revisit  map[string]time.Duration // 规则名 -> 重新抓取的间隔，覆盖 Rule.Revisit
+	Validate map[string]*Validation   // 规则名 -> 内容校验规则，覆盖 Rule.Validation
+	OnBan    []BanFunc                // 遇到封禁页面时调用
 	logger   *zap.Logger
 }
 
@@ -23,6 +30,8 @@ var defaultOptions = Options{
 	WaitTime: 5,
 	Reload:   false,
 	MaxDepth: 5,
+	Weight:   1,
+	Retry:    DefaultRetryPolicy,
 }
 
 type Option func(opts *Options)
@@ -80,3 +89,40 @@ func WithMaxDepth(maxDepth int64) Option {
 		opts.MaxDepth = maxDepth
 	}
 }
+
+func WithRetry(retry RetryPolicy) Option {
+	return func(opts *Options) {
+		opts.Retry = retry
+	}
+}
+
+func WithWeight(weight int) Option {
+	return func(opts *Options) {
+		opts.Weight = weight
+	}
+}
+
+func WithRobots(robots RobotsChecker) Option {
+	return func(opts *Options) {
+		opts.Robots = robots
+	}
+}
+
+func WithRevisit(revisit map[string]time.Duration) Option {
+	return func(opts *Options) {
+		opts.Revisit = revisit
+	}
+}
+
+func WithValidation(validate map[string]*Validation) Option {
+	return func(opts *Options) {
+		opts.Validate = validate
+	}
+}
+
+// 遇到封禁页面时调用，例如将使用的代理或 Cookie 标记为不可用
+func WithBanHandler(f BanFunc) Option {
+	return func(opts *Options) {
+		opts.OnBan = append(opts.OnBan, f)
+	}
+}
@@ -0,0 +1,230 @@
+package spider
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/andybalholm/cascadia"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	PageKey  = "page"       // TmpData 中当前页的页码
+	chainKey = "page_chain" // TmpData 中第一页的地址，用于识别同一组分页
+)
+
+// 一组分页超过该时间没有新的页面时丢弃记录的状态，
+// 例如某一页抓取失败、校验失败或进入死信队列后不会再调用 NextPage
+const chainTTL = time.Hour
+
+// 分页规则，每一页解析后才生成下一页的请求
+// 设置 Next 时跟随页面中的下一页链接，否则按 Template 生成下一页的地址；
+// 页面没有新的结果（包括空页面）、下一页已经抓取过或达到 MaxPages 时停止
+// 判断重复使用的已抓取页面与结果只保存在当前进程的内存中，重启后从恢复的请求继续时重新记录
+type Pagination struct {
+	Next     string `json:"next"`      // 下一页链接的 CSS 选择器，例如 a.next
+	Template string `json:"template"`  // 分页地址，{page} 替换为页码，{offset} 替换为 (页码 - Start) * Step
+	Start    int    `json:"start"`     // 第一页的页码，默认为 1
+	Step     int    `json:"step"`      // 每页的偏移量，默认为 1
+	MaxPages int    `json:"max_pages"` // 最多抓取的页数，为 0 时不限制
+
+	once   sync.Once
+	link   *LinkExtractor
+	lock   sync.Mutex
+	chains map[string]*pageChain
+}
+
+// 同一组分页已经抓取的页面与结果
+type pageChain struct {
+	urls    map[string]bool
+	results map[string]bool
+	updated time.Time
+}
+
+func (p *Pagination) init() {
+	p.once.Do(func() {
+		if p.Start == 0 {
+			p.Start = 1
+		}
+		if p.Step == 0 {
+			p.Step = 1
+		}
+		p.link = &LinkExtractor{CSS: p.Next}
+		p.chains = make(map[string]*pageChain)
+	})
+}
+
+// 检查下一页链接的选择器与过滤规则，Next 与 Template 都为空时返回错误
+func (p *Pagination) Compile() error {
+	if p == nil {
+		return nil
+	}
+	p.init()
+	if p.Next == "" {
+		if p.Template == "" {
+			return errors.New("next or template is required")
+		}
+		return nil
+	}
+	if _, err := cascadia.Compile(p.Next); err != nil {
+		return fmt.Errorf("next:%w", err)
+	}
+	return p.link.compile()
+}
+
+// 第 page 页的地址
+func (p *Pagination) URL(page int) string {
+	p.init()
+	r := strings.NewReplacer(
+		"{page}", strconv.Itoa(page),
+		"{offset}", strconv.Itoa((page-p.Start)*p.Step),
+	)
+	return r.Replace(p.Template)
+}
+
+// 按 Template 生成第一页的请求
+func (p *Pagination) First(ruleName string) (*Request, error) {
+	p.init()
+	if p.Template == "" {
+		return nil, errors.New("pagination template is empty")
+	}
+	req := &Request{
+		URL:      p.URL(p.Start),
+		Method:   "GET",
+		RuleName: ruleName,
+		TmpData:  &Temp{},
+	}
+	req.TmpData.Set(PageKey, p.Start)
+	return req, nil
+}
+
+// 请求的页码，没有记录时为第一页
+func (p *Pagination) page(req *Request) int {
+	if req.TmpData != nil {
+		switch n := req.TmpData.Get(PageKey).(type) {
+		case int:
+			return n
+		case float64:
+			// 从磁盘恢复的请求
+			return int(n)
+		}
+	}
+	return p.Start
+}
+
+// 按当前页的解析结果生成下一页的请求，需要停止时返回 nil
+func (p *Pagination) NextPage(c *Context, result ParseResult) (*Request, error) {
+	p.init()
+	page := p.page(c.Req)
+	chain := c.Req.URL
+	if c.Req.TmpData != nil {
+		if s, ok := c.Req.TmpData.Get(chainKey).(string); ok {
+			chain = s
+		}
+	}
+	key := chain
+	if c.Req.Task != nil {
+		key = c.Req.Task.Name + "\n" + chain
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	now := time.Now()
+	p.expire(now)
+	st, ok := p.chains[key]
+	if !ok {
+		st = &pageChain{urls: make(map[string]bool), results: make(map[string]bool)}
+		p.chains[key] = st
+	}
+	st.updated = now
+	stop := func() (*Request, error) {
+		delete(p.chains, key)
+		return nil, nil
+	}
+	if u, err := CanonicalURL(c.Req.URL); err == nil {
+		st.urls[u] = true
+	}
+
+	// 页面重复时不会产生新的结果
+	fresh := 0
+	for _, k := range resultKeys(result) {
+		if !st.results[k] {
+			st.results[k] = true
+			fresh++
+		}
+	}
+	if fresh == 0 {
+		return stop()
+	}
+	if p.MaxPages > 0 && page-p.Start+1 >= p.MaxPages {
+		return stop()
+	}
+
+	var next string
+	if p.Next != "" {
+		links, err := c.Links(p.link)
+		if err != nil {
+			delete(p.chains, key)
+			return nil, err
+		}
+		if len(links) > 0 {
+			next = links[0]
+		}
+	} else {
+		next = p.URL(page + 1)
+	}
+	if next == "" {
+		return stop()
+	}
+	if u, err := CanonicalURL(next); err == nil && st.urls[u] {
+		return stop()
+	}
+
+	req := &Request{
+		Task:     c.Req.Task,
+		URL:      next,
+		Method:   "GET",
+		Depth:    c.Req.Depth,
+		Priority: c.Req.Priority,
+		RuleName: c.Req.RuleName,
+		Header:   c.Req.Header.Clone(),
+		Session:  c.Req.Session,
+		TmpData:  c.Req.TmpData.clone(),
+	}
+	req.TmpData.Set(PageKey, page+1)
+	req.TmpData.Set(chainKey, chain)
+	return req, nil
+}
+
+// 丢弃超过 chainTTL 没有更新的分页状态，调用时需要持有锁
+func (p *Pagination) expire(now time.Time) {
+	for key, st := range p.chains {
+		if now.Sub(st.updated) > chainTTL {
+			delete(p.chains, key)
+		}
+	}
+}
+
+// 解析结果的指纹，用于判断页面是否产生了新的结果
+func resultKeys(result ParseResult) []string {
+	keys := make([]string, 0, len(result.Requesrts)+len(result.Items))
+	for _, r := range result.Requesrts {
+		keys = append(keys, "req:"+r.Unique())
+	}
+	for _, item := range result.Items {
+		var b []byte
+		if d, ok := item.(*DataCell); ok {
+			b, _ = json.Marshal(d.Data)
+		} else {
+			b = []byte(fmt.Sprint(item))
+		}
+		sum := md5.Sum(b)
+		keys = append(keys, "item:"+hex.EncodeToString(sum[:]))
+	}
+	return keys
+}
@@ -0,0 +1,111 @@
+package spider
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// 返回第 n 页的解析结果，每页两个子请求
+func pageResult(n int) ParseResult {
+	return ParseResult{Requesrts: []*Request{
+		{URL: fmt.Sprintf("http://a.com/topic/%d", n*2), Method: "GET"},
+		{URL: fmt.Sprintf("http://a.com/topic/%d", n*2+1), Method: "GET"},
+	}}
+}
+
+func TestPagination_Template(t *testing.T) {
+	task := &Task{Options: Options{Name: "group"}}
+	p := &Pagination{Template: "http://a.com/list?start={offset}&p={page}", Step: 25, MaxPages: 3}
+	req, err := p.First("list")
+	assert.Nil(t, err)
+	req.Task = task
+	assert.Equal(t, "http://a.com/list?start=0&p=1", req.URL)
+	assert.Equal(t, 1, req.TmpData.Get(PageKey))
+
+	var urls []string
+	for i := 0; req != nil; i++ {
+		urls = append(urls, req.URL)
+		req, err = p.NextPage(&Context{Req: req}, pageResult(i))
+		assert.Nil(t, err)
+		if req != nil {
+			assert.Equal(t, i+2, req.TmpData.Get(PageKey))
+			assert.Equal(t, "list", req.RuleName)
+			assert.Equal(t, task, req.Task)
+		}
+	}
+	assert.Equal(t, []string{
+		"http://a.com/list?start=0&p=1",
+		"http://a.com/list?start=25&p=2",
+		"http://a.com/list?start=50&p=3",
+	}, urls)
+	assert.Empty(t, p.chains)
+
+	// 空页面停止
+	p = &Pagination{Template: "http://a.com/list?page={page}"}
+	req, _ = p.First("list")
+	next, err := p.NextPage(&Context{Req: req}, pageResult(0))
+	assert.Nil(t, err)
+	assert.Equal(t, "http://a.com/list?page=2", next.URL)
+	next, err = p.NextPage(&Context{Req: next}, ParseResult{})
+	assert.Nil(t, err)
+	assert.Nil(t, next)
+
+	// 页面开始重复时停止，例如超出最后一页时返回最后一页的内容
+	req, _ = p.First("list")
+	next, _ = p.NextPage(&Context{Req: req}, pageResult(0))
+	next, _ = p.NextPage(&Context{Req: next}, pageResult(1))
+	assert.Equal(t, "http://a.com/list?page=3", next.URL)
+	next, _ = p.NextPage(&Context{Req: next}, pageResult(1))
+	assert.Nil(t, next)
+
+	// 从磁盘恢复的请求中页码为 float64
+	req = &Request{URL: "http://a.com/list?page=5", TmpData: &Temp{}}
+	req.TmpData.Set(PageKey, float64(5))
+	next, _ = p.NextPage(&Context{Req: req}, pageResult(5))
+	assert.Equal(t, "http://a.com/list?page=6", next.URL)
+
+	// 下一页抓取失败后不会再调用 NextPage，状态过期后被丢弃
+	assert.Len(t, p.chains, 1)
+	for _, st := range p.chains {
+		st.updated = time.Now().Add(-chainTTL - time.Second)
+	}
+	req, _ = p.First("list")
+	p.NextPage(&Context{Req: req}, pageResult(0))
+	assert.Len(t, p.chains, 1)
+	assert.NotNil(t, p.chains["http://a.com/list?page=1"])
+
+	// 每一页使用独立的请求头，修改下一页的请求头不影响当前页
+	req, _ = p.First("list")
+	req.Header = http.Header{"Referer": []string{"http://a.com/"}}
+	next, _ = p.NextPage(&Context{Req: req}, pageResult(7))
+	assert.Equal(t, "http://a.com/", next.Header.Get("Referer"))
+	next.Header.Set("Referer", "http://a.com/list?page=1")
+	assert.Equal(t, "http://a.com/", req.Header.Get("Referer"))
+}
+
+func TestPagination_Next(t *testing.T) {
+	p := &Pagination{Next: "a.next"}
+	page := func(url, body string, result ParseResult) *Request {
+		req := &Request{URL: url, RuleName: "list", Depth: 1}
+		next, err := p.NextPage(&Context{Req: req, Body: []byte(body)}, result)
+		assert.Nil(t, err)
+		return next
+	}
+
+	next := page("http://a.com/list", `<a class="next" href="?page=2#top">next</a>`, pageResult(0))
+	assert.Equal(t, "http://a.com/list?page=2", next.URL)
+	assert.Equal(t, 2, next.TmpData.Get(PageKey))
+	assert.Equal(t, int64(1), next.Depth)
+
+	// 下一页链接指回已经抓取的页面
+	req := &Request{URL: next.URL, RuleName: "list", TmpData: next.TmpData}
+	next, err := p.NextPage(&Context{Req: req, Body: []byte(`<a class="next" href="/list">next</a>`)}, pageResult(1))
+	assert.Nil(t, err)
+	assert.Nil(t, next)
+
+	// 没有下一页链接
+	assert.Nil(t, page("http://a.com/other", `<a href="?page=2">2</a>`, pageResult(2)))
+}
@@ -1,5 +1,14 @@
 package spider
 
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// 生成下一页请求失败，解析结果仍然有效
+var ErrPaginate = errors.New("paginate failed")
+
 // 采集规则树
 type RuleTree struct {
 	Root  func() ([]*Request, error) // 根节点(执行入口)
@@ -9,6 +18,77 @@ type RuleTree struct {
 // 采集规则节点
 type Rule struct {
 	ItemFields []string
+	Revisit    time.Duration // 重新抓取的间隔，为 0 时不重新抓取
+	Validation *Validation   // 解析前对响应内容的校验，为空时不校验
+	Extract    *Extraction   // 声明式的提取规则，提取的 item 追加在 ParseFunc 的结果之后
+	Schema     *Schema       // item 的结构，为空时由 ItemFields 或 Extract 生成
+	Paginate   *Pagination   // 分页规则，按解析结果生成同一规则的下一页请求
 	// todo: return *ParseResult
-	ParseFunc func(*Context) (ParseResult, error) // 内容解析函数
+	ParseFunc func(*Context) (ParseResult, error) // 内容解析函数，只使用 Extract 时可以为空
+}
+
+// 依次执行解析函数、提取规则与分页规则，引擎与缓存重放使用同一流程
+// 只有分页失败时返回已经解析的结果与包装了 ErrPaginate 的错误
+func (r *Rule) Parse(c *Context) (ParseResult, error) {
+	var result ParseResult
+	var err error
+	if r.ParseFunc != nil {
+		if result, err = r.ParseFunc(c); err != nil {
+			return result, err
+		}
+	}
+	if r.Extract != nil {
+		items, err := c.ExtractItems(r.Extract)
+		if err != nil {
+			return result, fmt.Errorf("extract failed:%w", err)
+		}
+		result.Items = append(result.Items, items...)
+	}
+	if r.Paginate != nil {
+		next, err := r.Paginate.NextPage(c, result)
+		if err != nil {
+			return result, fmt.Errorf("%w:%v", ErrPaginate, err)
+		}
+		if next != nil {
+			result.Requesrts = append(result.Requesrts, next)
+		}
+	}
+	return result, nil
+}
+
+// 存储的字段
+func (r *Rule) Fields() []string {
+	if s := r.ItemSchema(); s != nil {
+		return s.Names()
+	}
+	return nil
+}
+
+// item 的结构，没有声明 Schema 时按 ItemFields 生成不限类型的字段，
+// 没有设置 ItemFields 时使用提取规则的字段与类型，都没有设置时返回 nil
+func (r *Rule) ItemSchema() *Schema {
+	if r.Schema != nil {
+		return r.Schema
+	}
+	if len(r.ItemFields) == 0 && r.Extract == nil {
+		return nil
+	}
+	s := &Schema{}
+	if len(r.ItemFields) == 0 && r.Extract != nil {
+		for _, f := range r.Extract.Fields {
+			typ := f.Type
+			if typ == "" {
+				typ = TypeString
+			}
+			if f.Multiple {
+				typ = ""
+			}
+			s.Columns = append(s.Columns, Column{Name: f.Name, Type: typ})
+		}
+		return s
+	}
+	for _, name := range r.ItemFields {
+		s.Columns = append(s.Columns, Column{Name: name})
+	}
+	return s
 }
@@ -7,7 +7,11 @@ type (
 		Rules []RuleModle `json:"rule"`
 	}
 	RuleModle struct {
-		Name      string `json:"name"`
-		ParseFunc string `json:"parse_script"`
+		Name       string      `json:"name"`
+		ParseFunc  string      `json:"parse_script"`
+		Validation *Validation `json:"validation,omitempty"`
+		Extract    *Extraction `json:"extract,omitempty"`
+		Schema     *Schema     `json:"schema,omitempty"`
+		Paginate   *Pagination `json:"paginate,omitempty"`
 	}
 )
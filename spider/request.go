@@ -5,32 +5,51 @@ import (
 	"crypto/md5"
 	"encoding/hex"
 	"errors"
+	"fmt"
+	"golang.org/x/net/html"
 	"math/rand"
+	"net/http"
+	"net/url"
 	"regexp"
+	"strings"
 	"time"
 )
 
 type Context struct {
-	Body []byte
+	Body []byte // 等同于 Resp.Body
 	Req  *Request
+	Resp *Response
+	node *html.Node   // 解析后的 DOM，由 Node 方法创建
+	json *interface{} // 解析后的 JSON，由 JSON 方法创建
 }
 
 func (c *Context) GetRule(ruleName string) *Rule {
 	return c.Req.Task.Rule.Trunk[ruleName]
 }
 
-func (c *Context) Output(data interface{}) *DataCell {
+// 生成当前规则的 item，按规则的 Schema 校验字段；
+// 规则需要声明 Schema、ItemFields 或 Extract，否则返回 ErrInvalidItem
+func (c *Context) Output(data map[string]interface{}) (*DataCell, error) {
 	res := &DataCell{
 		Task: c.Req.Task,
+		Rule: c.Req.RuleName,
+		URL:  c.Req.URL,
+		Time: time.Now(),
+		Data: data,
 	}
-	res.Data = make(map[string]interface{})
-	res.Data["Task"] = c.Req.Task.Name
-	res.Data["Rule"] = c.Req.RuleName
-	res.Data["Data"] = data
-	res.Data["URL"] = c.Req.URL
-	res.Data["Time"] = time.Now().Format("2006-01-02 15:04:05")
-
-	return res
+	if c.Req.Task != nil {
+		if rule := c.GetRule(c.Req.RuleName); rule != nil {
+			res.Schema = rule.ItemSchema()
+		}
+	}
+	if res.Schema == nil {
+		// 每条 item 的字段可能不同，无法确定存储的表结构
+		return nil, fmt.Errorf("%w: rule %s declares no fields", ErrInvalidItem, c.Req.RuleName)
+	}
+	if err := res.Schema.Validate(data); err != nil {
+		return nil, err
+	}
+	return res, nil
 }
 
 func (c *Context) ParseJSReg(name string, reg string) ParseResult {
@@ -70,24 +89,128 @@ func (c *Context) OutputJS(reg string) ParseResult {
 	return result
 }
 
+var ErrDisallowed = errors.New("disallowed by robots.txt")
+
+// 暂时无法获取 robots.txt，请求按重试策略处理
+var ErrRobotsUnavailable = errors.New("robots.txt unavailable")
+
+// 服务端返回 304，页面自上次抓取后没有变化
+var ErrNotModified = errors.New("not modified")
+
+// 缓存校验信息，不为空时 Fetcher 发送条件请求
+type Validator struct {
+	ETag         string
+	LastModified string
+}
+
 // 单个请求
 type Request struct {
-	Task     *Task
-	URL      string
-	Method   string
-	Depth    int64
-	Priority int64
-	RuleName string
-	TmpData  *Temp
+	Task      *Task
+	URL       string
+	Method    string
+	Depth     int64
+	Priority  int64
+	RuleName  string
+	TmpData   *Temp
+	Attempts  int            // 已失败的次数
+	Header    http.Header    // 额外的请求头，会覆盖 Fetcher 设置的同名请求头
+	Query     url.Values     // 追加到 URL 上的查询参数
+	Body      []byte         // 请求体，使用 SetForm、SetJSON 设置时会同时设置 Content-Type
+	Cookies   []*http.Cookie // 额外的 Cookie，与任务的 Cookie 一起发送
+	Session   string         // 使用的会话，为空时由会话池分配
+	Proxy     string         // 本次抓取使用的代理，由代理池的中间件设置，不会持久化
+	Validator Validator
 }
 
-func (r *Request) Fetch() ([]byte, error) {
-	if err := r.Task.Limit.Wait(context.Background()); err != nil {
-		return nil, err
+// 可序列化的请求，用于将请求持久化到磁盘
+type RequestRecord struct {
+	TaskName string         `json:"task"`
+	URL      string         `json:"url"`
+	Method   string         `json:"method"`
+	Depth    int64          `json:"depth"`
+	Priority int64          `json:"priority"`
+	RuleName string         `json:"rule"`
+	TmpData  *Temp          `json:"tmp_data,omitempty"`
+	Attempts int            `json:"attempts"`
+	Header   http.Header    `json:"header,omitempty"`
+	Query    url.Values     `json:"query,omitempty"`
+	Body     []byte         `json:"body,omitempty"`
+	Cookies  []*http.Cookie `json:"cookies,omitempty"`
+	Session  string         `json:"session,omitempty"`
+}
+
+func (r *Request) Record() RequestRecord {
+	rec := RequestRecord{
+		URL:      r.URL,
+		Method:   r.Method,
+		Depth:    r.Depth,
+		Priority: r.Priority,
+		RuleName: r.RuleName,
+		TmpData:  r.TmpData,
+		Attempts: r.Attempts,
+		Header:   r.Header,
+		Query:    r.Query,
+		Body:     r.Body,
+		Cookies:  r.Cookies,
+		Session:  r.Session,
+	}
+	if r.Task != nil {
+		rec.TaskName = r.Task.Name
+	}
+	return rec
+}
+
+// 将记录还原为属于 task 的请求
+func (rec RequestRecord) Request(task *Task) *Request {
+	return &Request{
+		Task:     task,
+		URL:      rec.URL,
+		Method:   rec.Method,
+		Depth:    rec.Depth,
+		Priority: rec.Priority,
+		RuleName: rec.RuleName,
+		TmpData:  rec.TmpData,
+		Attempts: rec.Attempts,
+		Header:   rec.Header,
+		Query:    rec.Query,
+		Body:     rec.Body,
+		Cookies:  rec.Cookies,
+		Session:  rec.Session,
+	}
+}
+
+// ctx 取消时停止等待并返回 ctx.Err()，已经发出的请求不受影响
+func (r *Request) Fetch(ctx context.Context) (*Response, error) {
+	if r.Task.Robots != nil {
+		allowed, err := r.Task.Robots.Allowed(ctx, r.URL)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, err
+		}
+		if !allowed {
+			return nil, ErrDisallowed
+		}
+	}
+	if r.Task.Limit != nil {
+		if err := r.Task.Limit.Wait(ctx); err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, err
+		}
 	}
 	// 随机休眠，模拟人类行为
-	sleeptime := rand.Int63n(r.Task.WaitTime * 1000)
-	time.Sleep(time.Duration(sleeptime) * time.Millisecond)
+	// 使用 PoliteSchedule 按域名控制请求间隔时，可以将 WaitTime 设置为 0，避免阻塞 worker
+	if r.Task.WaitTime > 0 {
+		sleeptime := rand.Int63n(r.Task.WaitTime * 1000)
+		select {
+		case <-time.After(time.Duration(sleeptime) * time.Millisecond):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
 
 	return r.Task.Fetcher.Get(r)
 }
@@ -105,9 +228,42 @@ func (r *Request) Check() error {
 	return nil
 }
 
-// 请求的唯一识别码
+// 请求的唯一识别码，由规范化的完整 URL、method 与请求体生成
+// 查询参数的顺序、协议与域名的大小写、默认端口与锚点不影响识别码
 func (r *Request) Unique() string {
-	block := md5.Sum([]byte(r.URL + r.Method))
+	h := md5.New()
+	h.Write([]byte(r.uniqueURL() + r.Method))
+	h.Write(r.Body)
 
-	return hex.EncodeToString(block[:])
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// 用于生成唯一识别码的 URL，查询参数按名称排序，
+// 路径使用解码后的形式，与百分号编码的地址以及规范化之前的识别码一致
+func (r *Request) uniqueURL() string {
+	full := r.FullURL()
+	u, err := url.Parse(full)
+	if err != nil || u.Opaque != "" {
+		return full
+	}
+	c := Canonicalize(u, nil, false)
+	var b strings.Builder
+	if c.Scheme != "" {
+		b.WriteString(c.Scheme + ":")
+	}
+	if c.Host != "" || c.User != nil {
+		b.WriteString("//")
+		if c.User != nil {
+			b.WriteString(c.User.String() + "@")
+		}
+		b.WriteString(c.Host)
+	}
+	// 与之前的识别码保持一致，不为空路径补上 /
+	if u.Path != "" {
+		b.WriteString(c.Path)
+	}
+	if c.RawQuery != "" {
+		b.WriteString("?" + c.RawQuery)
+	}
+	return b.String()
 }
@@ -0,0 +1,56 @@
+package spider
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Fetcher 返回的响应
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	URL        string        // 跟随重定向后的最终地址
+	Redirects  []string      // 依次经过的重定向地址，不包括最终地址
+	Charset    string        // 检测到的原始编码，Body 已转换为 UTF-8
+	Elapsed    time.Duration // 从发出请求到读取完响应的耗时
+	Body       []byte
+	Screenshot []byte // 无头浏览器截取的页面图片，PNG 格式
+}
+
+// 响应的 Content-Type，不包括参数
+func (r *Response) ContentType() string {
+	if r == nil || r.Header == nil {
+		return ""
+	}
+	ct := r.Header.Get("Content-Type")
+	if i := strings.IndexByte(ct, ';'); i >= 0 {
+		ct = ct[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(ct))
+}
+
+// 以最终地址为基准解析相对地址
+func (r *Response) ResolveURL(ref string) (string, error) {
+	base, err := url.Parse(r.URL)
+	if err != nil {
+		return "", err
+	}
+	u, err := base.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// 服务端返回的缓存校验信息
+func (r *Response) Validator() Validator {
+	if r == nil || r.Header == nil {
+		return Validator{}
+	}
+	return Validator{
+		ETag:         r.Header.Get("ETag"),
+		LastModified: r.Header.Get("Last-Modified"),
+	}
+}
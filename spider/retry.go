@@ -0,0 +1,125 @@
+package spider
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// 带有 HTTP 状态码的请求错误
+type StatusError struct {
+	Code     int
+	Response *Response // 服务端返回的响应，可能为 nil
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("error status code:%d", e.Code)
+}
+
+// 返回错误中携带的状态码，没有状态码时返回 0
+func StatusCode(err error) int {
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.Code
+	}
+	return 0
+}
+
+// 返回错误中携带的响应，没有响应时返回 nil
+func ErrorResponse(err error) *Response {
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.Response
+	}
+	return nil
+}
+
+// 返回错误响应中 Retry-After 要求的等待时间，支持秒数与 HTTP 日期两种形式
+func RetryAfter(err error) time.Duration {
+	resp := ErrorResponse(err)
+	if resp == nil {
+		return 0
+	}
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if sec, err := strconv.Atoi(v); err == nil && sec > 0 {
+		return time.Duration(sec) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// 失败请求的重试策略
+type RetryPolicy struct {
+	MaxAttempts int           // 最大尝试次数，包含首次请求
+	BaseDelay   time.Duration // 首次重试的等待时间，之后指数增长
+	MaxDelay    time.Duration // 重试等待时间上限
+	RetryOn     []string      // 需要重试的状态码，支持 "429" 或 "5xx" 形式
+	GiveUpOn    []string      // 直接放弃的状态码，优先级高于 RetryOn
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 2,
+	BaseDelay:   time.Second,
+	MaxDelay:    time.Minute,
+	RetryOn:     []string{"429", "5xx"},
+	GiveUpOn:    []string{"404"},
+}
+
+// 判断已失败 attempts 次的请求是否需要重试
+// 没有状态码的错误(网络错误、内容校验失败等)总是重试
+func (p RetryPolicy) ShouldRetry(err error, attempts int) bool {
+	if attempts >= p.MaxAttempts {
+		return false
+	}
+	code := StatusCode(err)
+	if code == 0 {
+		return true
+	}
+	for _, pattern := range p.GiveUpOn {
+		if matchStatus(pattern, code) {
+			return false
+		}
+	}
+	for _, pattern := range p.RetryOn {
+		if matchStatus(pattern, code) {
+			return true
+		}
+	}
+	return false
+}
+
+// 第 attempts 次重试前的等待时间，指数退避并在 [d/2, d] 区间内随机抖动
+func (p RetryPolicy) Backoff(attempts int) time.Duration {
+	if p.BaseDelay <= 0 || attempts <= 0 {
+		return 0
+	}
+	d := p.BaseDelay
+	for i := 1; i < attempts; i++ {
+		d *= 2
+		if p.MaxDelay > 0 && d >= p.MaxDelay {
+			d = p.MaxDelay
+			break
+		}
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	half := int64(d / 2)
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+func matchStatus(pattern string, code int) bool {
+	if len(pattern) == 3 && pattern[1:] == "xx" {
+		return int(pattern[0]-'0') == code/100
+	}
+	c, err := strconv.Atoi(pattern)
+	return err == nil && c == code
+}
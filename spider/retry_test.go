@@ -0,0 +1,58 @@
+package spider
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy_ShouldRetry(t *testing.T) {
+	p := DefaultRetryPolicy
+	p.MaxAttempts = 3
+
+	tests := []struct {
+		name     string
+		err      error
+		attempts int
+		want     bool
+	}{
+		{name: "network error", err: errors.New("timeout"), attempts: 1, want: true},
+		{name: "too many requests", err: &StatusError{Code: 429}, attempts: 1, want: true},
+		{name: "server error", err: &StatusError{Code: 503}, attempts: 2, want: true},
+		{name: "not found", err: &StatusError{Code: 404}, attempts: 1, want: false},
+		{name: "forbidden", err: &StatusError{Code: 403}, attempts: 1, want: false},
+		{name: "max attempts", err: &StatusError{Code: 500}, attempts: 3, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, p.ShouldRetry(tt.err, tt.attempts))
+		})
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := RetryPolicy{BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+	for i := 0; i < 100; i++ {
+		d := p.Backoff(2)
+		assert.GreaterOrEqual(t, d, time.Second)
+		assert.LessOrEqual(t, d, 2*time.Second)
+
+		d = p.Backoff(10)
+		assert.GreaterOrEqual(t, d, 2500*time.Millisecond)
+		assert.LessOrEqual(t, d, 5*time.Second)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	resp := func(v string) error {
+		return &StatusError{Code: 429, Response: &Response{Header: http.Header{"Retry-After": []string{v}}}}
+	}
+	assert.Equal(t, 30*time.Second, RetryAfter(resp("30")))
+	d := RetryAfter(resp(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)))
+	assert.Greater(t, d, 50*time.Second)
+	assert.Zero(t, RetryAfter(resp("soon")))
+	assert.Zero(t, RetryAfter(&StatusError{Code: 429}))
+	assert.Zero(t, RetryAfter(errors.New("timeout")))
+}
@@ -0,0 +1,103 @@
+package spider
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"unicode/utf8"
+)
+
+// item 不符合规则声明的结构
+var ErrInvalidItem = errors.New("invalid item")
+
+// item 的一个字段，Type 与提取规则的类型相同，为空时不限制类型
+type Column struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Required  bool   `json:"required"`   // 值不能为 nil，字符串不能为空
+	MaxLength int    `json:"max_length"` // 字符串的最大字符数，为 0 时不限制
+}
+
+// item 的结构，Output 时校验，存储时按字段类型建表
+type Schema struct {
+	Columns []Column `json:"columns"`
+}
+
+// 字段名，按声明的顺序
+func (s *Schema) Names() []string {
+	names := make([]string, 0, len(s.Columns))
+	for _, c := range s.Columns {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+// 校验 item，不允许出现未声明的字段
+func (s *Schema) Validate(data map[string]interface{}) error {
+	columns := make(map[string]*Column, len(s.Columns))
+	for i := range s.Columns {
+		columns[s.Columns[i].Name] = &s.Columns[i]
+	}
+	for name := range data {
+		if _, ok := columns[name]; !ok {
+			return fmt.Errorf("%w: unknown field %s", ErrInvalidItem, name)
+		}
+	}
+	for i := range s.Columns {
+		if err := s.Columns[i].validate(data[s.Columns[i].Name]); err != nil {
+			return fmt.Errorf("%w: field %s %s", ErrInvalidItem, s.Columns[i].Name, err)
+		}
+	}
+	return nil
+}
+
+func (c *Column) validate(v interface{}) error {
+	if v == nil {
+		if c.Required {
+			return errors.New("is required")
+		}
+		return nil
+	}
+	rv := reflect.ValueOf(v)
+	switch c.Type {
+	case TypeString:
+		if rv.Kind() != reflect.String {
+			return fmt.Errorf("should be string, got %T", v)
+		}
+	case TypeInt:
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		case reflect.Float32, reflect.Float64:
+			// JSON 与 JS 中的数字都是浮点数
+			if f := rv.Float(); f != math.Trunc(f) {
+				return fmt.Errorf("should be int, got %v", f)
+			}
+		default:
+			return fmt.Errorf("should be int, got %T", v)
+		}
+	case TypeFloat:
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+		default:
+			return fmt.Errorf("should be float, got %T", v)
+		}
+	case TypeBool:
+		if rv.Kind() != reflect.Bool {
+			return fmt.Errorf("should be bool, got %T", v)
+		}
+	}
+	if rv.Kind() == reflect.String {
+		s := rv.String()
+		if c.Required && s == "" {
+			return errors.New("is required")
+		}
+		if c.MaxLength > 0 && utf8.RuneCountInString(s) > c.MaxLength {
+			return fmt.Errorf("exceeds max length %d", c.MaxLength)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package spider
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSchema_Validate(t *testing.T) {
+	s := &Schema{Columns: []Column{
+		{Name: "title", Type: TypeString, Required: true, MaxLength: 4},
+		{Name: "pages", Type: TypeInt},
+		{Name: "score", Type: TypeFloat},
+		{Name: "free", Type: TypeBool},
+		{Name: "tags"},
+	}}
+	assert.Equal(t, []string{"title", "pages", "score", "free", "tags"}, s.Names())
+
+	valid := []map[string]interface{}{
+		{"title": "小王子"},
+		{"title": "abcd", "pages": 97, "score": 9, "free": true, "tags": []string{"a"}},
+		{"title": "a", "pages": float64(97), "score": 9.1, "free": nil},
+	}
+	for _, data := range valid {
+		assert.Nil(t, s.Validate(data), data)
+	}
+
+	invalid := []map[string]interface{}{
+		{},
+		{"title": ""},
+		{"title": "abcde"},
+		{"title": "a", "pages": "97"},
+		{"title": "a", "pages": 9.5},
+		{"title": "a", "score": "9.1"},
+		{"title": "a", "free": "true"},
+		{"title": "a", "author": "b"},
+	}
+	for _, data := range invalid {
+		assert.ErrorIs(t, s.Validate(data), ErrInvalidItem, data)
+	}
+}
+
+func TestContext_Output(t *testing.T) {
+	task := &Task{Options: Options{Name: "book"}}
+	task.Rule.Trunk = map[string]*Rule{
+		"detail": {Schema: &Schema{Columns: []Column{{Name: "title", Type: TypeString, Required: true}}}},
+		"list":   {ItemFields: []string{"title", "url"}},
+		"any":    {},
+	}
+	ctx := &Context{Req: &Request{Task: task, URL: "http://book/1", RuleName: "detail"}}
+
+	cell, err := ctx.Output(map[string]interface{}{"title": "小王子"})
+	assert.Nil(t, err)
+	assert.Equal(t, "book_detail", cell.GetTableName())
+	assert.Equal(t, "detail", cell.Rule)
+	assert.Equal(t, "http://book/1", cell.URL)
+	assert.False(t, cell.Time.IsZero())
+	assert.Equal(t, task.Rule.Trunk["detail"].Schema, cell.Schema)
+
+	_, err = ctx.Output(map[string]interface{}{"title": 1})
+	assert.ErrorIs(t, err, ErrInvalidItem)
+
+	// 没有声明 Schema 时按 ItemFields 生成，不限制类型
+	ctx.Req.RuleName = "list"
+	cell, err = ctx.Output(map[string]interface{}{"title": 1})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"title", "url"}, cell.Schema.Names())
+
+	// 没有声明字段的规则无法确定表结构
+	ctx.Req.RuleName = "any"
+	_, err = ctx.Output(map[string]interface{}{"b": 1, "a": "x"})
+	assert.ErrorIs(t, err, ErrInvalidItem)
+
+	assert.Equal(t, "", (&DataCell{Data: map[string]interface{}{}}).GetTableName())
+	assert.Equal(t, "book", (&DataCell{Task: task}).GetTableName())
+}
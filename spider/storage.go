@@ -1,18 +1,34 @@
 package spider
 
+import "time"
+
 type Storage interface {
 	Save(datas ...*DataCell) error
+	Flush() error // 将缓冲区中的数据全部写入存储
 }
 
+// 解析出的一条数据，由 Context.Output 创建
 type DataCell struct {
-	Task *Task
-	Data map[string]interface{}
+	Task   *Task
+	Rule   string
+	URL    string
+	Time   time.Time
+	Schema *Schema                // 字段的名称与类型，存储时用于建表
+	Data   map[string]interface{} // 字段的值
 }
 
+// 存储的表名，不同规则的 item 结构不同，按任务与规则分表
 func (d *DataCell) GetTableName() string {
-	return d.Data["Task"].(string)
+	name := d.GetTaskName()
+	if name == "" || d.Rule == "" {
+		return name
+	}
+	return name + "_" + d.Rule
 }
 
 func (d *DataCell) GetTaskName() string {
-	return d.Data["Task"].(string)
+	if d.Task == nil {
+		return ""
+	}
+	return d.Task.Name
 }
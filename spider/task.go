@@ -1,6 +1,11 @@
 package spider
 
-import "sync"
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
 
 type Property struct {
 	Name     string `json:"name"` // 任务名称，应保证唯一性
@@ -12,13 +17,55 @@ type Property struct {
 }
 
 type TaskConfig struct {
-	Name     string
-	Cookie   string
-	WaitTime int64
-	Reload   bool
-	MaxDepth int64
-	Fetcher  string
-	Limits   []LimitCofig
+	Name        string
+	Cookie      string
+	WaitTime    int64
+	Reload      bool
+	MaxDepth    int64
+	Weight      int
+	Fetcher     string
+	Middlewares []MiddlewareConfig // 按顺序包装 Fetcher 的中间件
+	Limits      []LimitCofig
+	Retry       RetryConfig
+	Robots      RobotsConfig
+	Revisit     map[string]int         // 规则名 -> 重新抓取的间隔，秒
+	Validate    map[string]*Validation // 规则名 -> 内容校验规则
+	Sessions    SessionConfig
+	Browser     BrowserConfig // Fetcher 为 chrome 时的页面加载条件
+}
+
+type BrowserConfig struct {
+	Timeout      int    // 毫秒，为 0 时使用 collect.DefaultChromeTimeout
+	WaitSelector string // 等待出现的 CSS 选择器
+	WaitIdle     int    // 等待网络空闲的时间，毫秒
+	Screenshot   bool
+}
+
+type SessionConfig struct {
+	Enable   bool
+	Path     string // 会话的保存路径，默认为 data/sessions/<任务名>.json
+	Domain   string // 账号 Cookie 的作用域名，包括子域名
+	Cooldown int    // 会话被封禁后的冷却时间，秒
+	Accounts []AccountConfig
+}
+
+type AccountConfig struct {
+	ID     string
+	Cookie string // 浏览器中复制的 Cookie 字符串
+}
+
+type RobotsConfig struct {
+	Enable    bool
+	UserAgent string
+	TTL       int // 缓存时间，秒
+}
+
+type RetryConfig struct {
+	MaxAttempts int
+	BaseDelay   int // 毫秒
+	MaxDelay    int // 毫秒
+	RetryOn     []string
+	GiveUpOn    []string
 }
 
 type LimitCofig struct {
@@ -47,6 +94,73 @@ func NewTask(opts ...Option) *Task {
 	return d
 }
 
+// 判断请求是否被 robots.txt 禁止，暂时无法判断时返回错误
+type RobotsChecker interface {
+	Allowed(ctx context.Context, url string) (bool, error)
+}
+
+// 可以返回域名 Crawl-delay 的 RobotsChecker，PoliteSchedule 按域名应用该间隔
+type CrawlDelayer interface {
+	CrawlDelay(url string) time.Duration
+}
+
+// 规则的重新抓取间隔，为 0 时不重新抓取
+func (t *Task) RevisitInterval(ruleName string) time.Duration {
+	if d, ok := t.Revisit[ruleName]; ok {
+		return d
+	}
+	if rule, ok := t.Rule.Trunk[ruleName]; ok {
+		return rule.Revisit
+	}
+	return 0
+}
+
+// 规则的内容校验规则
+func (t *Task) Validation(ruleName string) *Validation {
+	if v, ok := t.Validate[ruleName]; ok {
+		return v
+	}
+	if rule, ok := t.Rule.Trunk[ruleName]; ok {
+		return rule.Validation
+	}
+	return nil
+}
+
+// 编译任务配置与所有规则的内容校验规则，返回第一个错误
+func (t *Task) CompileValidations() error {
+	for name, v := range t.Validate {
+		if err := v.Compile(); err != nil {
+			return fmt.Errorf("validation of rule %s:%w", name, err)
+		}
+	}
+	for name, rule := range t.Rule.Trunk {
+		if err := rule.Validation.Compile(); err != nil {
+			return fmt.Errorf("validation of rule %s:%w", name, err)
+		}
+	}
+	return nil
+}
+
+// 编译任务的内容校验、提取与分页规则，返回第一个错误
+// 规则有误时所有请求都会失败，任务加载时调用
+func (t *Task) Compile() error {
+	if err := t.CompileValidations(); err != nil {
+		return err
+	}
+	for name, rule := range t.Rule.Trunk {
+		if err := rule.Extract.Compile(); err != nil {
+			return fmt.Errorf("extraction of rule %s:%w", name, err)
+		}
+		if err := rule.Paginate.Compile(); err != nil {
+			return fmt.Errorf("pagination of rule %s:%w", name, err)
+		}
+	}
+	return nil
+}
+
+// 遇到封禁页面时的处理函数，resp 在封禁状态码时为空
+type BanFunc func(req *Request, resp *Response)
+
 type Fetcher interface {
-	Get(url *Request) ([]byte, error)
+	Get(url *Request) (*Response, error)
 }
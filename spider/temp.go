@@ -1,5 +1,7 @@
 package spider
 
+import "encoding/json"
+
 type Temp struct {
 	data map[string]interface{}
 }
@@ -18,3 +20,23 @@ func (t *Temp) Set(key string, value interface{}) error {
 
 	return nil
 }
+
+// 复制一份数据，t 为空时返回空的 Temp
+func (t *Temp) clone() *Temp {
+	c := &Temp{}
+	if t == nil {
+		return c
+	}
+	for k, v := range t.data {
+		c.Set(k, v)
+	}
+	return c
+}
+
+func (t *Temp) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.data)
+}
+
+func (t *Temp) UnmarshalJSON(b []byte) error {
+	return json.Unmarshal(b, &t.data)
+}
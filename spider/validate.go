@@ -0,0 +1,202 @@
+package spider
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// 响应内容的校验规则，所有条件都为空时不做任何校验
+type Validation struct {
+	MinSize            int      `json:"min_size"`            // 最小字节数
+	MaxSize            int      `json:"max_size"`            // 最大字节数
+	ContentTypes       []string `json:"content_types"`       // 允许的 Content-Type，例如 text/html、application/json
+	Required           []string `json:"required"`            // 内容必须匹配的正则
+	Forbidden          []string `json:"forbidden"`           // 内容不能匹配的正则
+	RequiredSelectors  []string `json:"required_selectors"`  // 必须存在的 CSS 选择器
+	ForbiddenSelectors []string `json:"forbidden_selectors"` // 不能存在的 CSS 选择器
+	BanPatterns        []string `json:"ban_patterns"`        // 内容匹配时视为封禁页面，例如验证码
+	BanSelectors       []string `json:"ban_selectors"`       // 存在时视为封禁页面的 CSS 选择器
+	BanURLs            []string `json:"ban_urls"`            // 重定向后的地址匹配时视为封禁页面
+	BanStatus          []int    `json:"ban_status"`          // 视为封禁的状态码，例如 403
+
+	once         sync.Once
+	err          error
+	required     []*regexp.Regexp
+	forbidden    []*regexp.Regexp
+	banBody      []*regexp.Regexp
+	banURLs      []*regexp.Regexp
+	requiredSels []cascadia.Selector
+	forbidSels   []cascadia.Selector
+	banSels      []cascadia.Selector
+}
+
+// 内容校验失败
+type ValidationError struct {
+	Reason string
+	Banned bool // 是否为封禁页面
+}
+
+func (e *ValidationError) Error() string {
+	if e.Banned {
+		return "banned: " + e.Reason
+	}
+	return "validation failed: " + e.Reason
+}
+
+func invalid(format string, args ...interface{}) error {
+	return &ValidationError{Reason: fmt.Sprintf(format, args...)}
+}
+
+func banned(format string, args ...interface{}) error {
+	return &ValidationError{Reason: fmt.Sprintf(format, args...), Banned: true}
+}
+
+func compileAll(patterns []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+func compileSelectors(sels []string) ([]cascadia.Selector, error) {
+	res := make([]cascadia.Selector, 0, len(sels))
+	for _, s := range sels {
+		sel, err := cascadia.Compile(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector %q:%w", s, err)
+		}
+		res = append(res, sel)
+	}
+	return res, nil
+}
+
+// 编译所有正则与 CSS 选择器，加载任务时调用，规则有误时应拒绝该任务
+func (v *Validation) Compile() error {
+	if v == nil {
+		return nil
+	}
+	v.once.Do(func() {
+		if v.required, v.err = compileAll(v.Required); v.err != nil {
+			return
+		}
+		if v.forbidden, v.err = compileAll(v.Forbidden); v.err != nil {
+			return
+		}
+		if v.banBody, v.err = compileAll(v.BanPatterns); v.err != nil {
+			return
+		}
+		if v.banURLs, v.err = compileAll(v.BanURLs); v.err != nil {
+			return
+		}
+		if v.requiredSels, v.err = compileSelectors(v.RequiredSelectors); v.err != nil {
+			return
+		}
+		if v.forbidSels, v.err = compileSelectors(v.ForbiddenSelectors); v.err != nil {
+			return
+		}
+		v.banSels, v.err = compileSelectors(v.BanSelectors)
+	})
+	return v.err
+}
+
+// 状态码是否表示被封禁
+func (v *Validation) BannedStatus(code int) bool {
+	if v == nil {
+		return false
+	}
+	for _, c := range v.BanStatus {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// 校验响应内容，失败时返回 *ValidationError
+// 优先检查封禁页面，封禁页面通常也无法通过其他校验
+// 规则本身有误时返回普通错误，任务加载时应已通过 Compile 检查
+func (v *Validation) Validate(resp *Response) error {
+	if v == nil {
+		return nil
+	}
+	if err := v.Compile(); err != nil {
+		return fmt.Errorf("compile validation failed:%w", err)
+	}
+
+	for _, re := range v.banURLs {
+		if re.MatchString(resp.URL) {
+			return banned("url %s matches %s", resp.URL, re)
+		}
+	}
+	for _, re := range v.banBody {
+		if re.Match(resp.Body) {
+			return banned("body matches %s", re)
+		}
+	}
+
+	var doc *goquery.Document
+	if len(v.banSels)+len(v.requiredSels)+len(v.forbidSels) > 0 {
+		var err error
+		doc, err = goquery.NewDocumentFromReader(bytes.NewReader(resp.Body))
+		if err != nil {
+			return invalid("parse html failed:%v", err)
+		}
+	}
+	for i, sel := range v.banSels {
+		if doc.FindMatcher(sel).Length() > 0 {
+			return banned("selector %s found", v.BanSelectors[i])
+		}
+	}
+
+	size := len(resp.Body)
+	if v.MinSize > 0 && size < v.MinSize {
+		return invalid("body too short:%d", size)
+	}
+	if v.MaxSize > 0 && size > v.MaxSize {
+		return invalid("body too long:%d", size)
+	}
+	if len(v.ContentTypes) > 0 {
+		ct := resp.ContentType()
+		ok := false
+		for _, t := range v.ContentTypes {
+			if strings.EqualFold(t, ct) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return invalid("unexpected content type:%s", ct)
+		}
+	}
+	for _, re := range v.required {
+		if !re.Match(resp.Body) {
+			return invalid("body does not match %s", re)
+		}
+	}
+	for _, re := range v.forbidden {
+		if re.Match(resp.Body) {
+			return invalid("body matches %s", re)
+		}
+	}
+	for i, sel := range v.requiredSels {
+		if doc.FindMatcher(sel).Length() == 0 {
+			return invalid("selector %s not found", v.RequiredSelectors[i])
+		}
+	}
+	for i, sel := range v.forbidSels {
+		if doc.FindMatcher(sel).Length() > 0 {
+			return invalid("selector %s found", v.ForbiddenSelectors[i])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package spider
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func TestValidation(t *testing.T) {
+	v := &Validation{
+		MinSize:            10,
+		ContentTypes:       []string{"text/html"},
+		Required:           []string{`<title>`},
+		ForbiddenSelectors: []string{"div.error"},
+		BanSelectors:       []string{"#captcha"},
+		BanURLs:            []string{`/misc/sorry`},
+		BanStatus:          []int{403},
+	}
+	html := http.Header{"Content-Type": []string{"text/html; charset=utf-8"}}
+
+	tests := []struct {
+		name    string
+		resp    *Response
+		invalid bool // 是否校验失败
+		banned  bool
+	}{
+		{"ok", &Response{URL: "http://a.com/", Header: html, Body: []byte("<html><title>ok</title></html>")}, false, false},
+		{"short", &Response{URL: "http://a.com/", Header: html, Body: []byte("<title>")}, true, false},
+		{"json", &Response{URL: "http://a.com/", Header: http.Header{"Content-Type": []string{"application/json"}}, Body: []byte(`{"title":"<title>"}`)}, true, false},
+		{"missing", &Response{URL: "http://a.com/", Header: html, Body: []byte("<html><body>nothing</body></html>")}, true, false},
+		{"error", &Response{URL: "http://a.com/", Header: html, Body: []byte(`<html><title>x</title><div class="error"></div></html>`)}, true, false},
+		{"captcha", &Response{URL: "http://a.com/", Header: html, Body: []byte(`<html><title>x</title><img id="captcha"></html>`)}, true, true},
+		{"sorry", &Response{URL: "https://www.douban.com/misc/sorry?original-url=x", Header: html, Body: []byte("<html><title>x</title></html>")}, true, true},
+	}
+	for _, tt := range tests {
+		err := v.Validate(tt.resp)
+		if !tt.invalid {
+			assert.Nil(t, err, tt.name)
+			continue
+		}
+		var ve *ValidationError
+		assert.True(t, errors.As(err, &ve), tt.name)
+		assert.Equal(t, tt.banned, ve.Banned, tt.name)
+	}
+
+	assert.True(t, v.BannedStatus(403))
+	assert.False(t, v.BannedStatus(404))
+
+	var empty *Validation
+	assert.Nil(t, empty.Validate(&Response{}))
+	assert.NotNil(t, (&Validation{Required: []string{"("}}).Validate(&Response{}))
+
+	// 加载任务时检查规则
+	assert.Nil(t, v.Compile())
+	assert.NotNil(t, (&Validation{BanSelectors: []string{"div["}}).Compile())
+	task := &Task{Options: Options{Validate: map[string]*Validation{"list": {Forbidden: []string{"("}}}}}
+	assert.NotNil(t, task.CompileValidations())
+	task = &Task{Rule: RuleTree{Trunk: map[string]*Rule{"list": {Validation: &Validation{RequiredSelectors: []string{"a:foo"}}}, "detail": {}}}}
+	assert.NotNil(t, task.CompileValidations())
+	assert.Nil(t, (&Task{}).CompileValidations())
+}
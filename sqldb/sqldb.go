@@ -67,12 +67,12 @@ func (d *Sqldb) CreateTable(t TableData) error {
 	if len(t.ColumnNames) == 0 {
 		return errors.New("column can not be empty")
 	}
-	sql := `CREATE TABLE IF NOT EXISTS ` + t.TableName + " ("
+	sql := `CREATE TABLE IF NOT EXISTS ` + quote(t.TableName) + " ("
 	if t.AutoKey {
 		sql += `id INT(12) NOT NULL PRIMARY KEY AUTO_INCREMENT,`
 	}
 	for _, t := range t.ColumnNames {
-		sql += t.Title + ` ` + t.Type + `,`
+		sql += quote(t.Title) + ` ` + t.Type + `,`
 	}
 	sql = sql[:len(sql)-1] + `) ENGINE=MyISAM DEFAULT CHARSET=utf8;`
 
@@ -88,7 +88,7 @@ func (d *Sqldb) DropTable(t TableData) error {
 		return errors.New("column can not be empty")
 	}
 
-	sql := `DROP TABLE ` + t.TableName
+	sql := `DROP TABLE ` + quote(t.TableName)
 
 	d.logger.Debug("drop table", zap.String("sql", sql))
 
@@ -101,10 +101,10 @@ func (d *Sqldb) Insert(t TableData) error {
 	if len(t.ColumnNames) == 0 {
 		return errors.New("empty column")
 	}
-	sql := `INSERT INTO ` + t.TableName + `(`
+	sql := `INSERT INTO ` + quote(t.TableName) + `(`
 
 	for _, v := range t.ColumnNames {
-		sql += v.Title + ","
+		sql += quote(v.Title) + ","
 	}
 
 	sql = sql[:len(sql)-1] + `) VALUES `
@@ -115,3 +115,8 @@ func (d *Sqldb) Insert(t TableData) error {
 	_, err := d.db.Exec(sql, t.Args...)
 	return err
 }
+
+// 表名与字段名来自任务与规则的名称，使用反引号包裹后作为标识符
+func quote(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
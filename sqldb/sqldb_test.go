@@ -173,3 +173,8 @@ func TestSqldb_InsertTable(t *testing.T) {
 		})
 	}
 }
+
+func TestQuote(t *testing.T) {
+	assert.Equal(t, "`douban_book_list_书籍简介`", quote("douban_book_list_书籍简介"))
+	assert.Equal(t, "`a``; DROP TABLE b`", quote("a`; DROP TABLE b"))
+}
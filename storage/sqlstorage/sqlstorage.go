@@ -3,16 +3,17 @@ package sqlstorage
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"go.uber.org/zap"
-	"gocrawler/engine"
 	"gocrawler/spider"
 	"gocrawler/sqldb"
+	"reflect"
 )
 
 type SQLStore struct {
 	dataDocker []*spider.DataCell //分批输出结果缓存
 	db         sqldb.DBer
-	Table      map[string]struct{}
+	Table      map[string]*spider.Schema // 已经创建的表及其结构
 	options
 }
 
@@ -23,7 +24,7 @@ func New(opts ...Option) (*SQLStore, error) {
 	}
 	s := &SQLStore{}
 	s.options = options
-	s.Table = make(map[string]struct{})
+	s.Table = make(map[string]*spider.Schema)
 	var err error
 	s.db, err = sqldb.New(
 		sqldb.WithConnURL(s.sqlURL),
@@ -39,9 +40,13 @@ func New(opts ...Option) (*SQLStore, error) {
 func (s *SQLStore) Save(dataCells ...*spider.DataCell) error {
 	for _, cell := range dataCells {
 		name := cell.GetTableName()
-		if _, ok := s.Table[name]; !ok {
-			// 获取当前数据的表字段与字段类型
-			columnNames := getFields(cell)
+		if name == "" || cell.Schema == nil {
+			s.logger.Error("invalid data cell", zap.String("table", name), zap.String("url", cell.URL))
+			continue
+		}
+		if schema, ok := s.Table[name]; !ok {
+			// 按 item 的结构获取表字段与字段类型
+			columnNames := getFields(cell.Schema)
 
 			err := s.db.CreateTable(sqldb.TableData{
 				TableName:   name,
@@ -52,11 +57,17 @@ func (s *SQLStore) Save(dataCells ...*spider.DataCell) error {
 				s.logger.Error("create table falied", zap.Error(err))
 				continue
 			}
-			s.Table[name] = struct{}{}
+			s.Table[name] = cell.Schema
+		} else if schema != cell.Schema && !reflect.DeepEqual(schema.Columns, cell.Schema.Columns) {
+			// 同一个表只能保存一种结构的 item
+			s.logger.Error("schema mismatch", zap.String("table", name), zap.String("url", cell.URL))
+			continue
 		}
 		if len(s.dataDocker) >= s.BatchCount {
 			// 如果缓冲区已经满了，则调用 SqlStore.Flush() 方法批量插入数据
-			s.Flush()
+			if err := s.Flush(); err != nil {
+				s.logger.Error("insert data failed", zap.Error(err))
+			}
 		}
 		// 如果当前的数据小于 s.BatchCount，则将数据放入到缓存中直接返回 (用缓冲区批量插入数据库可以提高程序的性能)
 		s.dataDocker = append(s.dataDocker, cell)
@@ -64,77 +75,110 @@ func (s *SQLStore) Save(dataCells ...*spider.DataCell) error {
 	return nil
 }
 
-func getFields(cell *spider.DataCell) []sqldb.Field {
-	taskName := cell.Data["Task"].(string)
-	ruleName := cell.Data["Rule"].(string)
-	fields := engine.GetFields(taskName, ruleName)
-
+func getFields(schema *spider.Schema) []sqldb.Field {
 	var columnNames []sqldb.Field
-	for _, field := range fields {
+	for _, c := range schema.Columns {
 		columnNames = append(columnNames, sqldb.Field{
-			Title: field,
-			Type:  "MEDIUMTEXT",
+			Title: c.Name,
+			Type:  columnType(c),
 		})
 	}
 	columnNames = append(columnNames,
 		sqldb.Field{Title: "URL", Type: "VARCHAR(255)"},
-		sqldb.Field{Title: "Time", Type: "VARCHAR(255)"},
+		sqldb.Field{Title: "Time", Type: "DATETIME"},
 	)
 	return columnNames
 }
 
+// 字段类型对应的 MySQL 类型，未限制类型的字段保存为 JSON 文本
+func columnType(c spider.Column) string {
+	var typ string
+	switch c.Type {
+	case spider.TypeInt:
+		typ = "BIGINT"
+	case spider.TypeFloat:
+		typ = "DOUBLE"
+	case spider.TypeBool:
+		typ = "TINYINT(1)"
+	default:
+		typ = "MEDIUMTEXT"
+		if c.Type == spider.TypeString && c.MaxLength > 0 && c.MaxLength <= 255 {
+			typ = fmt.Sprintf("VARCHAR(%d)", c.MaxLength)
+		}
+	}
+	if c.Required {
+		typ += " NOT NULL"
+	}
+	return typ
+}
+
+// 按字段的顺序生成插入的值
+func values(cell *spider.DataCell) []interface{} {
+	value := make([]interface{}, 0, len(cell.Schema.Columns)+2)
+	for _, c := range cell.Schema.Columns {
+		switch v := cell.Data[c.Name].(type) {
+		case nil, string, bool,
+			int, int8, int16, int32, int64,
+			uint, uint8, uint16, uint32, uint64,
+			float32, float64:
+			value = append(value, v)
+		default:
+			j, err := json.Marshal(v)
+			if err != nil {
+				value = append(value, nil)
+			} else {
+				value = append(value, string(j))
+			}
+		}
+	}
+	return append(value, cell.URL, cell.Time.Format("2006-01-02 15:04:05"))
+}
+
+// 按表分批插入缓冲区中的数据，Save 保证同一个表的数据结构相同
+// 某个表插入失败时继续插入其他表，失败的数据保留在缓冲区中等待下次 Flush，返回所有表的错误
 func (s *SQLStore) Flush() error {
 	if len(s.dataDocker) == 0 {
 		return nil
 	}
-	args := make([]interface{}, 0)
 
-	var ruleName string
-	var taskName string
-	var ok bool
+	var errs []error
+	var tables []string
+	batches := make(map[string][]*spider.DataCell)
 	for _, datacell := range s.dataDocker {
-		if ruleName, ok = datacell.Data["Rule"].(string); !ok {
-			return errors.New("no rule field")
+		// 缺少任务或结构的数据无法插入，直接丢弃
+		if datacell.Task == nil {
+			errs = append(errs, errors.New("no task field"))
+			continue
 		}
-
-		if taskName, ok = datacell.Data["Task"].(string); !ok {
-			return errors.New("no task field")
+		if datacell.Schema == nil {
+			errs = append(errs, errors.New("no schema"))
+			continue
 		}
-		fields := engine.GetFields(taskName, ruleName)
-		data := datacell.Data["Data"].(map[string]interface{})
-		value := []string{}
-		for _, field := range fields {
-			v := data[field]
-			switch v.(type) {
-			case nil:
-				value = append(value, "")
-			case string:
-				value = append(value, v.(string))
-			default:
-				j, err := json.Marshal(v)
-				if err != nil {
-					value = append(value, "")
-				} else {
-					value = append(value, string(j))
-				}
-			}
+		name := datacell.GetTableName()
+		if _, ok := batches[name]; !ok {
+			tables = append(tables, name)
 		}
+		batches[name] = append(batches[name], datacell)
+	}
 
-		if v, ok := datacell.Data["URL"].(string); ok {
-			value = append(value, v)
-		}
-		if v, ok := datacell.Data["Time"].(string); ok {
-			value = append(value, v)
+	var failed []*spider.DataCell
+	for _, name := range tables {
+		cells := batches[name]
+		args := make([]interface{}, 0)
+		for _, datacell := range cells {
+			args = append(args, values(datacell)...)
 		}
-		for _, v := range value {
-			args = append(args, v)
+		err := s.db.Insert(sqldb.TableData{
+			TableName:   name,
+			ColumnNames: getFields(cells[0].Schema),
+			Args:        args,
+			DataCount:   len(cells),
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("insert table %s:%w", name, err))
+			failed = append(failed, cells...)
 		}
 	}
-
-	return s.db.Insert(sqldb.TableData{
-		TableName:   s.dataDocker[0].GetTableName(),
-		ColumnNames: getFields(s.dataDocker[0]),
-		Args:        args,
-		DataCount:   len(s.dataDocker),
-	})
+	s.dataDocker = failed
+	return errors.Join(errs...)
 }
@@ -1,34 +1,37 @@
 package sqlstorage
 
 import (
+	"errors"
 	"github.com/stretchr/testify/assert"
-	"gocrawler/engine"
+	"go.uber.org/zap"
 	"gocrawler/parse/doubanbook"
-	"gocrawler/parse/doubangroup"
-	"gocrawler/parse/doubangroupjs"
 	"gocrawler/spider"
 	"gocrawler/sqldb"
 	"testing"
+	"time"
 )
 
-func init() {
-	engine.Store.Add(doubangroup.DoubangroupTask)
-	engine.Store.Add(doubanbook.DoubanBookTask)
-	engine.Store.AddJSTask(doubangroupjs.DoubangroupJSTask)
-}
-
 type mysqldb struct {
+	created  []string
+	inserted []sqldb.TableData
+	fail     map[string]bool // 插入失败的表
 }
 
-func (m mysqldb) CreateTable(t sqldb.TableData) error {
+func (m *mysqldb) CreateTable(t sqldb.TableData) error {
+	m.created = append(m.created, t.TableName)
 	return nil
 }
 
-func (m mysqldb) Insert(t sqldb.TableData) error {
+func (m *mysqldb) Insert(t sqldb.TableData) error {
+	if m.fail[t.TableName] {
+		return errors.New("insert failed")
+	}
+	m.inserted = append(m.inserted, t)
 	return nil
 }
 
 func TestSQLStorage_Flush(t *testing.T) {
+	schema := doubanbook.DoubanBookTask.Rule.Trunk["书籍简介"].ItemSchema()
 	type fields struct {
 		dataDocker []*spider.DataCell
 		options    options
@@ -39,21 +42,21 @@ func TestSQLStorage_Flush(t *testing.T) {
 		wantErr bool
 	}{
 		{name: "empty", wantErr: false},
-		{name: "no Rule filed", fields: fields{dataDocker: []*spider.DataCell{
-			{Data: map[string]interface{}{"url": "http://xxx.com"}},
-		}}, wantErr: true},
 		{name: "no Task filed", fields: fields{dataDocker: []*spider.DataCell{
-			{Data: map[string]interface{}{"url": "http://xxx.com"}},
+			{Schema: schema, Data: map[string]interface{}{"书名": "小王子"}},
+		}}, wantErr: true},
+		{name: "no Schema", fields: fields{dataDocker: []*spider.DataCell{
+			{Task: doubanbook.DoubanBookTask, Data: map[string]interface{}{"书名": "小王子"}},
 		}}, wantErr: true},
 		{name: "right data", fields: fields{dataDocker: []*spider.DataCell{
-			{Data: map[string]interface{}{"Rule": "书籍简介", "Task": "douban_book_list", "Data": map[string]interface{}{"url": "http://xxx.com"}}},
+			{Task: doubanbook.DoubanBookTask, Rule: "书籍简介", Schema: schema, Data: map[string]interface{}{"书名": "小王子"}},
 		}}, wantErr: false},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			s := &SQLStore{
 				dataDocker: tt.fields.dataDocker,
-				db:         mysqldb{},
+				db:         &mysqldb{},
 				options:    tt.fields.options,
 			}
 			if err := s.Flush(); (err != nil) != tt.wantErr {
@@ -63,3 +66,87 @@ func TestSQLStorage_Flush(t *testing.T) {
 		})
 	}
 }
+
+func TestSQLStorage_Save(t *testing.T) {
+	task := doubanbook.DoubanBookTask
+	book := task.Rule.Trunk["书籍简介"].ItemSchema()
+	tag := &spider.Schema{Columns: []spider.Column{{Name: "tag"}}}
+	db := &mysqldb{}
+	s := &SQLStore{db: db, Table: make(map[string]*spider.Schema), options: options{logger: zap.NewNop(), BatchCount: 10}}
+
+	err := s.Save(
+		&spider.DataCell{Task: task, Rule: "书籍简介", Schema: book, Data: map[string]interface{}{"书名": "小王子"}},
+		// 没有 Schema 或任务的数据被丢弃
+		&spider.DataCell{Task: task, Rule: "书籍简介", Data: map[string]interface{}{"书名": "小王子"}},
+		&spider.DataCell{Rule: "书籍简介", Schema: book, Data: map[string]interface{}{"书名": "小王子"}},
+		// 不同规则的数据保存在不同的表中
+		&spider.DataCell{Task: task, Rule: "tag", Schema: tag, Data: map[string]interface{}{"tag": "小说"}},
+		&spider.DataCell{Task: task, Rule: "书籍简介", Schema: book, Data: map[string]interface{}{"书名": "围城"}},
+		// 与已经创建的表结构不同
+		&spider.DataCell{Task: task, Rule: "tag", Schema: book, Data: map[string]interface{}{"书名": "小王子"}},
+	)
+	assert.Nil(t, err)
+	assert.Len(t, s.dataDocker, 3)
+	assert.Equal(t, []string{task.Name + "_书籍简介", task.Name + "_tag"}, db.created)
+
+	assert.Nil(t, s.Flush())
+	assert.Len(t, db.inserted, 2)
+	assert.Equal(t, task.Name+"_书籍简介", db.inserted[0].TableName)
+	assert.Equal(t, 2, db.inserted[0].DataCount)
+	assert.Equal(t, getFields(book), db.inserted[0].ColumnNames)
+	assert.Equal(t, task.Name+"_tag", db.inserted[1].TableName)
+	assert.Equal(t, []interface{}{"小说", "", "0001-01-01 00:00:00"}, db.inserted[1].Args)
+}
+
+func TestSQLStorage_FlushFailure(t *testing.T) {
+	task := doubanbook.DoubanBookTask
+	book := task.Rule.Trunk["书籍简介"].ItemSchema()
+	tag := &spider.Schema{Columns: []spider.Column{{Name: "tag"}}}
+	db := &mysqldb{fail: map[string]bool{task.Name + "_书籍简介": true}}
+	s := &SQLStore{db: db, dataDocker: []*spider.DataCell{
+		{Task: task, Rule: "书籍简介", Schema: book, Data: map[string]interface{}{"书名": "小王子"}},
+		{Task: task, Rule: "tag", Schema: tag, Data: map[string]interface{}{"tag": "小说"}},
+	}}
+
+	// 一个表失败时其他表仍然插入，失败的数据保留到下次 Flush
+	assert.ErrorContains(t, s.Flush(), task.Name+"_书籍简介")
+	assert.Len(t, db.inserted, 1)
+	assert.Equal(t, task.Name+"_tag", db.inserted[0].TableName)
+	assert.Len(t, s.dataDocker, 1)
+	assert.Equal(t, "书籍简介", s.dataDocker[0].Rule)
+
+	db.fail = nil
+	assert.Nil(t, s.Flush())
+	assert.Len(t, db.inserted, 2)
+	assert.Empty(t, s.dataDocker)
+}
+
+func TestGetFields(t *testing.T) {
+	schema := &spider.Schema{Columns: []spider.Column{
+		{Name: "title", Type: spider.TypeString, Required: true, MaxLength: 100},
+		{Name: "intro", Type: spider.TypeString},
+		{Name: "pages", Type: spider.TypeInt},
+		{Name: "score", Type: spider.TypeFloat},
+		{Name: "free", Type: spider.TypeBool},
+		{Name: "tags"},
+	}}
+	assert.Equal(t, []sqldb.Field{
+		{Title: "title", Type: "VARCHAR(100) NOT NULL"},
+		{Title: "intro", Type: "MEDIUMTEXT"},
+		{Title: "pages", Type: "BIGINT"},
+		{Title: "score", Type: "DOUBLE"},
+		{Title: "free", Type: "TINYINT(1)"},
+		{Title: "tags", Type: "MEDIUMTEXT"},
+		{Title: "URL", Type: "VARCHAR(255)"},
+		{Title: "Time", Type: "DATETIME"},
+	}, getFields(schema))
+
+	now := time.Date(2023, 1, 2, 3, 4, 5, 0, time.Local)
+	cell := &spider.DataCell{
+		URL:    "http://xxx.com",
+		Time:   now,
+		Schema: schema,
+		Data:   map[string]interface{}{"title": "a", "pages": 97, "tags": []string{"x", "y"}},
+	}
+	assert.Equal(t, []interface{}{"a", nil, 97, nil, nil, `["x","y"]`, "http://xxx.com", "2023-01-02 03:04:05"}, values(cell))
+}